@@ -0,0 +1,93 @@
+package core
+
+import "fmt"
+
+// MoveTo returns a copy of the state in which the workflow instance starts the step of the given scope,
+// e.g. "deploy/validate", regardless of its current events.
+// The scope is the fully qualified scope name, as found in the state.
+func (sf *stepFlowImpl) MoveTo(state State, scope string) (State, error) {
+	return sf.moveState(state, StartCommand(&scopeImpl{name: scope}))
+}
+
+// Skip returns a copy of the state in which the step of the given scope is completed without running it,
+// so the workflow instance continues with the step that follows it.
+func (sf *stepFlowImpl) Skip(state State, scope string) (State, error) {
+	return sf.moveState(state, CompletedEvent(&scopeImpl{name: scope}))
+}
+
+// RestartScope returns a copy of the state in which the group of steps of the given scope starts again.
+// All the current events of the workflow instance must be within the scope.
+func (sf *stepFlowImpl) RestartScope(state State, scope string) (State, error) {
+	expanded, err := sf.ExpandState(state)
+	if err != nil {
+		return State{}, err
+	}
+
+	for _, event := range expanded.Events {
+		parsed, err := ParseEvent(event)
+		if err != nil {
+			return State{}, err
+		}
+
+		if !isSameOrParentScope(scope, parsed.Scope().Name()) {
+			return State{}, fmt.Errorf("cannot restart scope %s: event %s is not within the scope", scope, event)
+		}
+	}
+
+	return sf.moveState(state, StartCommand(&scopeImpl{name: scope}))
+}
+
+// moveState returns a copy of the state whose events are replaced with the given event, which must be known
+// to the workflow definition. The unhandled failure, if any, is cleared, compact states are kept compact,
+// encrypted data is encrypted again for the new events and the new state is signed, if a signing key is configured.
+func (sf *stepFlowImpl) moveState(state State, event Event) (State, error) {
+	if err := checkStateVersion(state.Version); err != nil {
+		return State{}, err
+	}
+
+	if err := sf.verifyState(state); err != nil {
+		return State{}, err
+	}
+
+	if err := sf.checkFingerprint(state.Metadata); err != nil {
+		return State{}, err
+	}
+
+	_, isCompact := state.Metadata[dictionaryKey]
+	newState, err := sf.ExpandState(state)
+	if err != nil {
+		return State{}, err
+	}
+
+	target := eventString(event)
+	if !sf.isKnownEvent(target) {
+		return State{}, fmt.Errorf("unknown event %s", target)
+	}
+
+	newState = newState.Clone()
+	if err := sf.decryptData(&newState); err != nil {
+		return State{}, err
+	}
+
+	newState.Events = []string{target}
+	delete(newState.Metadata, failedScopeKey)
+	delete(newState.Metadata, failureKey)
+	delete(newState.Data, failureKey)
+	sf.nextRevision(&newState)
+
+	if err := sf.encryptData(&newState); err != nil {
+		return State{}, err
+	}
+
+	if isCompact {
+		if newState, err = sf.CompactState(newState); err != nil {
+			return State{}, err
+		}
+	}
+
+	if err := sf.signState(&newState); err != nil {
+		return State{}, err
+	}
+
+	return newState, nil
+}
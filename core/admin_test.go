@@ -0,0 +1,77 @@
+package core_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestAdminOperations(t *testing.T) {
+	var calls []string
+	activity := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	sf, err := core.NewStepFlow(core.NewStepsItem("deploy", []core.StepFlowItem{
+		core.NewFuncItem("prepare", activity("prepare")),
+		core.NewStepsItem("rollout", []core.StepFlowItem{
+			core.NewFuncItem("validate", activity("validate")),
+			core.NewFuncItem("deploy", activity("deploy")),
+		}),
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	state := core.StateFromStrings([]string{"completed:deploy/rollout/validate"})
+
+	// Move to a step
+	moved, err := sf.MoveTo(state, "deploy/prepare")
+	if err != nil {
+		t.Fatalf("MoveTo returned an error: %v", err)
+	}
+
+	if !reflect.DeepEqual(moved.Events, []string{"start:deploy/prepare"}) {
+		t.Fatalf("Unexpected events %v", moved.Events)
+	}
+
+	// Skip a step, the instance continues with the next one
+	skipped, err := sf.Skip(moved, "deploy/prepare")
+	if err != nil {
+		t.Fatalf("Skip returned an error: %v", err)
+	}
+
+	_, err = sf.ApplyState(context.Background(), skipped)
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	if !reflect.DeepEqual(calls, []string{"validate"}) {
+		t.Fatalf("Expected only validate to be called, got %v", calls)
+	}
+
+	// Restart the group containing the current event
+	restarted, err := sf.RestartScope(state, "deploy/rollout")
+	if err != nil {
+		t.Fatalf("RestartScope returned an error: %v", err)
+	}
+
+	if !reflect.DeepEqual(restarted.Events, []string{"start:deploy/rollout"}) {
+		t.Fatalf("Unexpected events %v", restarted.Events)
+	}
+
+	// The group must contain the current events
+	if _, err := sf.RestartScope(moved, "deploy/rollout"); err == nil {
+		t.Fatal("Expected an error for a scope not containing the current events")
+	}
+
+	// Unknown scopes are rejected
+	if _, err := sf.MoveTo(state, "deploy/unknown"); err == nil {
+		t.Fatal("Expected an error for an unknown scope")
+	}
+}
@@ -0,0 +1,34 @@
+package core
+
+import "context"
+
+// attemptsKey is the state data key holding the number of consecutive failures of each source event.
+// It is only saved when WithAttempts is enabled.
+const attemptsKey = "attempts"
+
+// recordAttempt updates the number of consecutive failures of the given source event in the state data:
+// it is incremented if err is not nil, and reset otherwise.
+func recordAttempt(ctx context.Context, source Event, err error) {
+	attempts := variablesFromContext(ctx, attemptsKey)
+	if err == nil {
+		attempts.Delete(eventString(source))
+		return
+	}
+
+	var failures int
+	if _, getErr := attempts.Get(eventString(source), &failures); getErr != nil {
+		failures = 0
+	}
+
+	_ = attempts.Set(eventString(source), failures+1)
+}
+
+// currentAttempt returns the attempt of the given source event, i.e. its number of consecutive failures, starting at 1.
+func currentAttempt(ctx context.Context, source Event) int {
+	var failures int
+	if _, err := variablesFromContext(ctx, attemptsKey).Get(eventString(source), &failures); err != nil || failures < 1 {
+		return 1
+	}
+
+	return failures
+}
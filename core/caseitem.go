@@ -59,6 +59,9 @@ func (ci *caseItem) Transitions(parent Scope) (Scope, []Transition, error) {
 
 		// When the item completes, complete the case.
 		NewStaticTransition(CompletedEvent(itemScope), CompletedEvent(scope)),
+
+		// When the item fails, re-raise the failure.
+		reRaiseFailure(itemScope),
 	}
 
 	// Add all transitions for the item
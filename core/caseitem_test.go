@@ -38,12 +38,13 @@ func TestNewCaseItem(t *testing.T) {
 		t.Fatalf("Expected scope name 'test', got '%s'", scope.Name())
 	}
 
-	// For a case with a child, we should have 3 transitions:
+	// For a case with a child, we should have 4 transitions:
 	// 1. Start case -> Start child or Completed case (from condition)
-	// 2. Start child -> Completed child (from child)
-	// 3. Completed child -> Completed case
-	if len(transitions) != 3 {
-		t.Fatalf("Expected 3 transitions, got %d", len(transitions))
+	// 2. Completed child -> Completed case
+	// 3. Failed child -> Failed case
+	// 4. Start child -> Completed child (from child)
+	if len(transitions) != 4 {
+		t.Fatalf("Expected 4 transitions, got %d", len(transitions))
 	}
 
 	// Check transition source and destination for the conditional transition
@@ -195,7 +196,7 @@ func TestCaseItem_Error(t *testing.T) {
 	_, err = sf.Apply(context.Background(), nil)
 
 	// Check the error
-	if err != expectedErr {
+	if !errors.Is(err, expectedErr) {
 		t.Fatalf("Expected error %v, got %v", expectedErr, err)
 	}
 }
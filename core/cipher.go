@@ -0,0 +1,170 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// encryptedKey is the state data key holding the encrypted data section, see WithCipher.
+const encryptedKey = "encrypted"
+
+// Cipher encrypts the data section of the state at rest, see WithCipher.
+type Cipher interface {
+	// Encrypt encrypts and authenticates the given plaintext, and authenticates the given additional data.
+	Encrypt(plaintext []byte, additionalData []byte) ([]byte, error)
+
+	// Decrypt decrypts a ciphertext returned by Encrypt, provided the same additional data.
+	Decrypt(ciphertext []byte, additionalData []byte) ([]byte, error)
+}
+
+// keyIDSize is the size of the key id prepended to AES-GCM ciphertexts.
+const keyIDSize = 4
+
+// aesGCMCipher is the AES-GCM implementation of the Cipher interface.
+// Ciphertexts are made of the id of the key, the nonce and the sealed plaintext.
+type aesGCMCipher struct {
+	current [keyIDSize]byte
+	aeads   map[[keyIDSize]byte]cipher.AEAD
+}
+
+// NewAESGCMCipher creates a new AES-GCM cipher that encrypts with the given key and decrypts with the given key
+// or any of the old keys, to support key rotation. Keys must be 16, 24 or 32 bytes long.
+func NewAESGCMCipher(key []byte, oldKeys ...[]byte) (Cipher, error) {
+	c := &aesGCMCipher{aeads: make(map[[keyIDSize]byte]cipher.AEAD)}
+	for i, k := range append([][]byte{key}, oldKeys...) {
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		id := keyID(k)
+		if i == 0 {
+			c.current = id
+		}
+		c.aeads[id] = aead
+	}
+
+	return c, nil
+}
+
+// keyID returns the id of the given key, derived from its SHA-256 hash.
+func keyID(key []byte) [keyIDSize]byte {
+	sum := sha256.Sum256(key)
+	return [keyIDSize]byte(sum[:keyIDSize])
+}
+
+// Encrypt implements the Cipher interface.
+func (c *aesGCMCipher) Encrypt(plaintext []byte, additionalData []byte) ([]byte, error) {
+	aead := c.aeads[c.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ciphertext := append(c.current[:], nonce...)
+	return aead.Seal(ciphertext, nonce, plaintext, additionalData), nil
+}
+
+// Decrypt implements the Cipher interface.
+func (c *aesGCMCipher) Decrypt(ciphertext []byte, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < keyIDSize {
+		return nil, errors.New("invalid ciphertext")
+	}
+
+	aead, found := c.aeads[[keyIDSize]byte(ciphertext[:keyIDSize])]
+	if !found {
+		return nil, errors.New("unknown encryption key")
+	}
+
+	ciphertext = ciphertext[keyIDSize:]
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("invalid ciphertext")
+	}
+
+	return aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], additionalData)
+}
+
+// additionalData returns the data the encrypted data section of the state is bound to: its readable events,
+// and the metadata identifying the workflow instance and the Apply call that produced it. Encrypted data
+// moved to another state does not decrypt, even when the states are not signed.
+func additionalData(state State) ([]byte, error) {
+	bound := State{Events: state.Events}
+	for _, key := range []string{startedAtKey, revisionKey} {
+		if value, found := state.Metadata[key]; found {
+			bound.SetMetadata(key, value)
+		}
+	}
+
+	return bound.MarshalBinary()
+}
+
+// decryptData replaces the encrypted data section of the state with the decrypted one.
+func (sf *stepFlowImpl) decryptData(state *State) error {
+	encrypted, found := state.Data[encryptedKey]
+	if !found {
+		return nil
+	}
+
+	if sf.options.cipher == nil {
+		return errors.New("cannot read encrypted state data without a cipher")
+	}
+
+	var ciphertext []byte
+	if err := json.Unmarshal(encrypted, &ciphertext); err != nil {
+		return fmt.Errorf("invalid encrypted state data: %w", err)
+	}
+
+	ad, err := additionalData(*state)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := sf.options.cipher.Decrypt(ciphertext, ad)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt state data: %w", err)
+	}
+
+	state.Data = nil
+	return json.Unmarshal(plaintext, &state.Data)
+}
+
+// encryptData replaces the data section of the state with the encrypted one, if a cipher is configured.
+// It must be called once the events and metadata of the state are final, see additionalData.
+func (sf *stepFlowImpl) encryptData(state *State) error {
+	if sf.options.cipher == nil || len(state.Data) == 0 {
+		return nil
+	}
+
+	plaintext, err := json.Marshal(state.Data)
+	if err != nil {
+		return err
+	}
+
+	ad, err := additionalData(*state)
+	if err != nil {
+		return err
+	}
+
+	ciphertext, err := sf.options.cipher.Encrypt(plaintext, ad)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := json.Marshal(ciphertext)
+	if err != nil {
+		return err
+	}
+
+	state.Data = map[string]json.RawMessage{encryptedKey: encrypted}
+	return nil
+}
@@ -0,0 +1,190 @@
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestCipher(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	newFlow := func(c core.Cipher) core.StepFlow {
+		sf, err := core.NewStepFlow(core.NewStepsItem("onboard", []core.StepFlowItem{
+			core.NewFuncItem("register", func(ctx context.Context) error {
+				return core.Vars(ctx).Set("customerId", "c-42")
+			}),
+			core.NewWaitForItem("verifyWaitFor", func(ctx context.Context) (bool, error) {
+				var customerId string
+				_, err := core.Vars(ctx).Get("customerId", &customerId)
+				return customerId == "c-42", err
+			}),
+		}), core.WithCipher(c))
+		if err != nil {
+			t.Fatalf("Failed to create step flow: %v", err)
+		}
+
+		return sf
+	}
+
+	oldCipher, err := core.NewAESGCMCipher(oldKey)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+
+	state, err := newFlow(oldCipher).ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	// The data section is encrypted, the events stay readable
+	if _, found := state.Data["vars"]; found || bytes.Contains(state.Data["encrypted"], []byte("c-42")) {
+		t.Fatalf("Expected encrypted data, got %s", state.Data)
+	}
+
+	if state.Events[0] != "completed:onboard/register" {
+		t.Fatalf("Unexpected events %v", state.Events)
+	}
+
+	// Rotate the key, the state encrypted with the old key is still readable and is encrypted again with the new key
+	rotatedCipher, err := core.NewAESGCMCipher(newKey, oldKey)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+
+	state, err = newFlow(rotatedCipher).ApplyState(context.Background(), state)
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	newCipher, err := core.NewAESGCMCipher(newKey)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+
+	sf := newFlow(newCipher)
+	for range 2 {
+		state, err = sf.ApplyState(context.Background(), state)
+		if err != nil {
+			t.Fatalf("ApplyState returned an error: %v", err)
+		}
+	}
+
+	if !sf.IsCompleted(state.Strings()) {
+		t.Fatalf("Expected completed state, got %v", state.Events)
+	}
+
+	// Encrypted data cannot be read without a cipher
+	plain, err := core.NewStepFlow(core.NewStepsItem("onboard", nil))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	if _, err := plain.ApplyState(context.Background(), state); err == nil {
+		t.Fatal("Expected an error for encrypted data without a cipher")
+	}
+}
+
+func TestCipher_FailureAndBinding(t *testing.T) {
+	c, err := core.NewAESGCMCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+
+	failing := true
+	sf, err := core.NewStepFlow(core.NewStepsItem("onboard", []core.StepFlowItem{
+		core.NewFuncItem("register", func(ctx context.Context) error {
+			return core.Vars(ctx).Set("customerId", "c-42")
+		}),
+		core.NewFuncItem("verify", func(ctx context.Context) error {
+			if failing {
+				return errors.New("customer c-42 not found")
+			}
+			return nil
+		}),
+	}), core.WithCipher(c), core.WithFailureEvents(true))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	registered, err := sf.ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	// The failure message is encrypted along with the data, only the failed scope stays readable
+	failed, err := sf.ApplyState(context.Background(), registered)
+	var failureErr *core.FailureError
+	if !errors.As(err, &failureErr) || failureErr.Message != "customer c-42 not found" {
+		t.Fatalf("Expected a *FailureError, got %v", err)
+	}
+
+	if _, found := failed.Metadata["failure"]; found || failed.Metadata["failedScope"] != "onboard/verify" {
+		t.Fatalf("Expected an encrypted failure message, got %v", failed.Metadata)
+	}
+
+	if _, err := sf.ApplyState(context.Background(), failed); !errors.As(err, &failureErr) || failureErr.Message != "customer c-42 not found" {
+		t.Fatalf("Expected the decrypted failure message, got %v", err)
+	}
+
+	// Encrypted data is bound to its state, so it cannot be moved to another one
+	swapped := failed.Clone()
+	swapped.Data = registered.Clone().Data
+	if _, err := sf.ApplyState(context.Background(), swapped); err == nil {
+		t.Fatal("Expected an error for encrypted data of another state")
+	}
+
+	// Admin operations encrypt the data again for the new events
+	failing = false
+	moved, err := sf.MoveTo(failed, "onboard/verify")
+	if err != nil {
+		t.Fatalf("MoveTo returned an error: %v", err)
+	}
+
+	for range 2 {
+		if moved, err = sf.ApplyState(context.Background(), moved); err != nil {
+			t.Fatalf("ApplyState returned an error: %v", err)
+		}
+	}
+
+	if !sf.IsCompleted(moved.Strings()) {
+		t.Fatalf("Expected a completed state, got %v", moved.Events)
+	}
+}
+
+func TestCipher_History(t *testing.T) {
+	c, err := core.NewAESGCMCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+
+	sf, err := core.NewStepFlow(core.NewStepsItem("onboard", []core.StepFlowItem{
+		core.NewFuncItem("register", func(ctx context.Context) error { return nil }),
+	}), core.WithCipher(c), core.WithHistory(10), core.WithCompactState(true))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	state, err := sf.ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	// The history is encrypted with the data, so it cannot be read without the cipher
+	if _, err := core.HistoryFromState(state); err == nil {
+		t.Fatal("Expected an error for encrypted data")
+	}
+
+	entries, err := sf.History(state)
+	if err != nil {
+		t.Fatalf("History returned an error: %v", err)
+	}
+
+	if len(entries) != 2 || entries[0].Source != "start:onboard" || entries[1].Source != "start:onboard/register" {
+		t.Fatalf("Unexpected history %+v", entries)
+	}
+}
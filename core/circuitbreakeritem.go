@@ -0,0 +1,217 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState string
+
+const (
+	// CircuitClosed is the state in which calls are allowed and failures are counted.
+	CircuitClosed CircuitState = "closed"
+
+	// CircuitOpen is the state in which calls are deferred until the open duration has passed.
+	CircuitOpen CircuitState = "open"
+
+	// CircuitHalfOpen is the state in which a single trial call is allowed to probe whether the failures are over.
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitBreakerMetrics is a point in time snapshot of a CircuitBreaker, intended for metrics reporting.
+type CircuitBreakerMetrics struct {
+	// State is the current state of the circuit breaker.
+	State CircuitState
+
+	// ConsecutiveFailures is the number of failures recorded since the last success.
+	ConsecutiveFailures int
+
+	// Opens is the number of times the circuit breaker has opened.
+	Opens int
+
+	// Deferrals is the number of calls that were deferred while the circuit breaker was not closed.
+	Deferrals int
+}
+
+// CircuitBreaker tracks failures of the steps it guards. It is safe for concurrent use and is meant
+// to be shared by all the workflow instances that call the same downstream system.
+// It opens after failureThreshold consecutive failures, and allows a single trial call once
+// openDuration has passed. A successful trial closes it, a failed trial opens it again.
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	failureThreshold int
+	openDuration     time.Duration
+	state            CircuitState
+	openedAt         time.Time
+	trialStartedAt   time.Time
+	metrics          CircuitBreakerMetrics
+	now              func() time.Time
+}
+
+// NewCircuitBreaker creates a new closed circuit breaker.
+func NewCircuitBreaker(failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{failureThreshold: failureThreshold, openDuration: openDuration, state: CircuitClosed, now: time.Now}
+}
+
+// WithClock sets the function used to read the current time, mainly for tests, and returns the circuit breaker.
+// It must be called before the circuit breaker is shared. The default is time.Now.
+func (cb *CircuitBreaker) WithClock(now func() time.Time) *CircuitBreaker {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.now = now
+	return cb
+}
+
+// Allow reports whether a guarded call can proceed.
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := cb.now()
+
+	switch cb.state {
+	case CircuitOpen:
+		if now.Sub(cb.openedAt) < cb.openDuration {
+			break
+		}
+
+		// The open duration has passed, allow a trial call.
+		cb.state = CircuitHalfOpen
+		cb.trialStartedAt = now
+		return true
+	case CircuitHalfOpen:
+		if now.Sub(cb.trialStartedAt) < cb.openDuration {
+			break
+		}
+
+		// The trial call never reported back, allow another one.
+		cb.trialStartedAt = now
+		return true
+	default:
+		return true
+	}
+
+	cb.metrics.Deferrals++
+	return false
+}
+
+// RecordSuccess records a successful guarded call and closes the circuit breaker.
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.state = CircuitClosed
+	cb.metrics.ConsecutiveFailures = 0
+}
+
+// RecordFailure records a failed guarded call and opens the circuit breaker when the failure threshold
+// is reached or when the trial call failed.
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.metrics.ConsecutiveFailures++
+
+	if cb.state == CircuitHalfOpen || (cb.state == CircuitClosed && cb.metrics.ConsecutiveFailures >= cb.failureThreshold) {
+		cb.state = CircuitOpen
+		cb.openedAt = cb.now()
+		cb.metrics.Opens++
+	}
+}
+
+// State returns the current state of the circuit breaker.
+func (cb *CircuitBreaker) State() CircuitState {
+	return cb.Metrics().State
+}
+
+// Metrics returns a snapshot of the circuit breaker state and counters.
+func (cb *CircuitBreaker) Metrics() CircuitBreakerMetrics {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	metrics := cb.metrics
+	metrics.State = cb.state
+	return metrics
+}
+
+// circuitBreakerTransition wraps another transition to defer it while the circuit breaker does not allow calls.
+type circuitBreakerTransition struct {
+	transition Transition
+	breaker    *CircuitBreaker
+}
+
+// Source returns the source event of the wrapped transition.
+func (ct *circuitBreakerTransition) Source() Event {
+	return ct.transition.Source()
+}
+
+// Destination evaluates the wrapped transition if the circuit breaker allows it, and records the outcome.
+// Otherwise, it returns the source event, leaving the state unchanged.
+func (ct *circuitBreakerTransition) Destination(ctx context.Context) ([]Event, error) {
+	if !ct.breaker.Allow() {
+		return []Event{ct.transition.Source()}, nil
+	}
+
+	events, err := ct.transition.Destination(ctx)
+	if err != nil || containsEvent(events, FailedEvent(ct.transition.Source().Scope())) {
+		ct.breaker.RecordFailure()
+		return events, err
+	}
+
+	ct.breaker.RecordSuccess()
+	return events, nil
+}
+
+// IsExclusive delegates to the wrapped transition.
+func (ct *circuitBreakerTransition) IsExclusive() bool {
+	return ct.transition.IsExclusive()
+}
+
+// PossibleDestinations returns all possible destinations, including the source event for deferred calls.
+func (ct *circuitBreakerTransition) PossibleDestinations() []PossibleDestination {
+	var result []PossibleDestination
+	result = append(result, ct.transition.PossibleDestinations()...)
+	result = append(result, NewReason(ct.transition.Source(), "circuit breaker is open"))
+	return result
+}
+
+// circuitBreakerItem wraps another workflow item to guard its exclusive transitions with a circuit breaker.
+// Like retryItem, it does not add any new events or transitions.
+type circuitBreakerItem struct {
+	item    StepFlowItem
+	breaker *CircuitBreaker
+}
+
+// NewCircuitBreakerItem creates a new workflow item that guards the given item with the given circuit breaker.
+// Failures of the item are recorded in the circuit breaker. While the circuit breaker is open, the item's
+// exclusive transitions are deferred: the state is left unchanged and the step is attempted again on a later Apply.
+// Errors retried by a Retry nested in the item are not seen by the circuit breaker, so Retry should wrap it instead.
+func NewCircuitBreakerItem(item StepFlowItem, breaker *CircuitBreaker) StepFlowItem {
+	return &circuitBreakerItem{item: item, breaker: breaker}
+}
+
+// Transitions implements the StepFlowItem interface.
+// It wraps each exclusive transition of the contained item. Non-exclusive transitions do not call
+// any user function and are kept as is.
+func (ci *circuitBreakerItem) Transitions(parent Scope) (Scope, []Transition, error) {
+	// Get the item's scope and transitions.
+	itemScope, itemTransitions, err := ci.item.Transitions(parent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var transitions []Transition
+	for _, transition := range itemTransitions {
+		if !transition.IsExclusive() {
+			transitions = append(transitions, transition)
+			continue
+		}
+
+		transitions = append(transitions, &circuitBreakerTransition{transition: transition, breaker: ci.breaker})
+	}
+
+	return itemScope, transitions, nil
+}
@@ -0,0 +1,143 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestNewCircuitBreakerItem(t *testing.T) {
+	// Create a circuit breaker item wrapping steps with a function item
+	breaker := core.NewCircuitBreaker(1, time.Minute)
+	item := core.NewCircuitBreakerItem(core.NewStepsItem("guarded", []core.StepFlowItem{
+		core.NewFuncItem("child", func(ctx context.Context) error { return nil }),
+	}), breaker)
+
+	// Get transitions
+	scope, transitions, err := item.Transitions(nil)
+	if err != nil {
+		t.Fatalf("Transitions returned an error: %v", err)
+	}
+
+	// The circuit breaker item keeps the scope of the wrapped item
+	if scope.Name() != "guarded" {
+		t.Fatalf("Expected scope name 'guarded', got '%s'", scope.Name())
+	}
+
+	// Check transitions - only the function transition should be deferrable
+	if len(transitions) != 4 {
+		t.Fatalf("Expected 4 transitions, got %d", len(transitions))
+	}
+
+	for _, transition := range transitions {
+		foundDeferred := false
+		for _, pd := range transition.PossibleDestinations() {
+			if pd.Reason() == "circuit breaker is open" {
+				foundDeferred = true
+			}
+		}
+
+		if foundDeferred != transition.IsExclusive() {
+			t.Fatalf("Unexpected possible destinations for transition from %s", transition.Source().Name())
+		}
+	}
+}
+
+func TestCircuitBreakerItem_SharedAcrossInstances(t *testing.T) {
+	// Track calls
+	callCount := 0
+	failing := true
+
+	// Create a circuit breaker shared by the flow instances
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := core.NewCircuitBreaker(2, time.Minute).WithClock(func() time.Time { return now })
+	sf, err := core.NewStepFlow(core.NewCircuitBreakerItem(core.NewFuncItem("child", func(ctx context.Context) error {
+		callCount++
+		if failing {
+			return errors.New("downstream is down")
+		}
+		return nil
+	}), breaker))
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Two instances fail and open the circuit breaker
+	for i := range 2 {
+		_, err = sf.Apply(context.Background(), nil)
+		if err == nil {
+			t.Fatalf("[%d] Expected an error", i)
+		}
+	}
+
+	if breaker.State() != core.CircuitOpen {
+		t.Fatalf("Expected state %s, got %s", core.CircuitOpen, breaker.State())
+	}
+
+	// A third instance is deferred without calling the function
+	state, err := sf.Apply(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Apply returned an error: %v", err)
+	}
+
+	if fmt.Sprintf("%s", state) != "[start:child]" {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	if callCount != 2 {
+		t.Fatalf("Expected function to be called 2 times, got %d", callCount)
+	}
+
+	// After the open duration, a successful trial closes the circuit breaker
+	failing = false
+	now = now.Add(time.Minute)
+
+	state, err = sf.Apply(context.Background(), state)
+	if err != nil {
+		t.Fatalf("Apply returned an error: %v", err)
+	}
+
+	if !sf.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	metrics := breaker.Metrics()
+	if metrics.State != core.CircuitClosed || metrics.Opens != 1 || metrics.Deferrals != 1 || metrics.ConsecutiveFailures != 0 {
+		t.Fatalf("Unexpected metrics %+v", metrics)
+	}
+}
+
+func TestCircuitBreaker_FailedTrialReopens(t *testing.T) {
+	// Create an open circuit breaker
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := core.NewCircuitBreaker(1, time.Minute).WithClock(func() time.Time { return now })
+	breaker.RecordFailure()
+
+	if breaker.Allow() {
+		t.Fatal("Open circuit breaker should not allow calls")
+	}
+
+	// After the open duration a single trial call is allowed
+	now = now.Add(time.Minute)
+	if !breaker.Allow() {
+		t.Fatal("Circuit breaker should allow a trial call")
+	}
+
+	if breaker.Allow() {
+		t.Fatal("Circuit breaker should allow a single trial call")
+	}
+
+	// A failed trial opens the circuit breaker again
+	breaker.RecordFailure()
+	if breaker.State() != core.CircuitOpen {
+		t.Fatalf("Expected state %s, got %s", core.CircuitOpen, breaker.State())
+	}
+
+	if breaker.Metrics().Opens != 2 {
+		t.Fatalf("Expected 2 opens, got %d", breaker.Metrics().Opens)
+	}
+}
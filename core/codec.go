@@ -0,0 +1,122 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// eventSeparator separates the event name from the scope name in the string representation of an event.
+	eventSeparator = ":"
+
+	// scopeSeparator separates the names of nested scopes.
+	scopeSeparator = "/"
+
+	// escapeChar starts the percent-encoded form of a reserved character.
+	escapeChar = "%"
+)
+
+// nameEscaper escapes the reserved characters of scope names.
+var nameEscaper = strings.NewReplacer(escapeChar, "%25", eventSeparator, "%3A", scopeSeparator, "%2F")
+
+// EscapeName escapes the reserved characters ':', '/' and '%' of a scope name, so that the string
+// representation of events can be parsed unambiguously. Names are not escaped by NewScope, so that the states
+// of existing workflows stay valid: escaping a name used by running instances changes the events of their states.
+func EscapeName(name string) string {
+	return nameEscaper.Replace(name)
+}
+
+// UnescapeName reverses EscapeName.
+func UnescapeName(name string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != escapeChar[0] {
+			sb.WriteByte(name[i])
+			continue
+		}
+
+		if i+2 >= len(name) {
+			return "", fmt.Errorf("invalid escape sequence in name %s", name)
+		}
+
+		switch name[i : i+3] {
+		case "%25":
+			sb.WriteString(escapeChar)
+		case "%3A":
+			sb.WriteString(eventSeparator)
+		case "%2F":
+			sb.WriteString(scopeSeparator)
+		default:
+			return "", fmt.Errorf("invalid escape sequence in name %s", name)
+		}
+		i += 2
+	}
+
+	return sb.String(), nil
+}
+
+// ValidateName returns an error if the given step name is empty or contains a reserved character.
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+
+	if strings.ContainsAny(name, eventSeparator+scopeSeparator+escapeChar) {
+		return fmt.Errorf("name %s must not contain any of the reserved characters %s", name, eventSeparator+scopeSeparator+escapeChar)
+	}
+
+	return nil
+}
+
+// FormatEvent returns the string representation of an event, as stored in the state.
+func FormatEvent(event Event) string {
+	return eventString(event)
+}
+
+// ParseEvent parses the string representation of an event, as stored in the state.
+// The returned event scope has one parent scope per "/" separated name, whose unescaped names are
+// returned by ScopeNames.
+func ParseEvent(str string) (Event, error) {
+	name, scopeName, found := strings.Cut(str, eventSeparator)
+	if !found || name == "" || scopeName == "" {
+		return nil, fmt.Errorf("invalid event %s", str)
+	}
+
+	var scope Scope
+	for _, segment := range strings.Split(scopeName, scopeSeparator) {
+		if segment == "" {
+			return nil, fmt.Errorf("invalid event %s: empty scope name", str)
+		}
+
+		if _, err := UnescapeName(segment); err != nil {
+			return nil, fmt.Errorf("invalid event %s: %w", str, err)
+		}
+
+		scope = WithParent(&scopeImpl{name: segment}, scope)
+	}
+
+	return NewEvent(name, scope), nil
+}
+
+// ScopeNames returns the unescaped names of the given scope and of its parents, outermost first,
+// e.g. ["deploy", "db:migrate"] for the scope "deploy/db%3Amigrate".
+func ScopeNames(scope Scope) ([]string, error) {
+	var names []string
+	for ; scope != nil; scope = scope.Parent() {
+		name := scope.Name()
+		if parent := scope.Parent(); parent != nil {
+			name = strings.TrimPrefix(name, parent.Name()+scopeSeparator)
+		}
+
+		unescaped, err := UnescapeName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, unescaped)
+	}
+
+	slices.Reverse(names)
+	return names, nil
+}
@@ -0,0 +1,93 @@
+package core_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestEscapeName(t *testing.T) {
+	// Escape a name with all the reserved characters
+	escaped := core.EscapeName("db:migrate/v1 100%")
+	if escaped != "db%3Amigrate%2Fv1 100%25" {
+		t.Fatalf("Unexpected escaped name %s", escaped)
+	}
+
+	// Unescape it back
+	name, err := core.UnescapeName(escaped)
+	if err != nil {
+		t.Fatalf("UnescapeName returned an error: %v", err)
+	}
+
+	if name != "db:migrate/v1 100%" {
+		t.Fatalf("Unexpected name %s", name)
+	}
+
+	// Invalid escape sequences are rejected
+	for _, invalid := range []string{"100%", "100%2", "100%41"} {
+		if _, err := core.UnescapeName(invalid); err == nil {
+			t.Fatalf("Expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	// Create an event in a nested scope with reserved characters
+	root := core.NewScope(core.EscapeName("deploy/v1"))
+	scope := core.WithParent(core.NewScope(core.EscapeName("db:migrate")), root)
+	event := core.StartCommand(scope)
+
+	str := core.FormatEvent(event)
+	if str != "start:deploy%2Fv1/db%3Amigrate" {
+		t.Fatalf("Unexpected event string %s", str)
+	}
+
+	// Parse the event back
+	parsed, err := core.ParseEvent(str)
+	if err != nil {
+		t.Fatalf("ParseEvent returned an error: %v", err)
+	}
+
+	if parsed.Name() != "start" || parsed.Scope().Name() != scope.Name() {
+		t.Fatalf("Unexpected event %s:%s", parsed.Name(), parsed.Scope().Name())
+	}
+
+	if parsed.Scope().Parent() == nil || parsed.Scope().Parent().Name() != root.Name() {
+		t.Fatalf("Unexpected parent scope %v", parsed.Scope().Parent())
+	}
+
+	if parsed.Scope().Parent().Parent() != nil {
+		t.Fatalf("Unexpected root scope parent %v", parsed.Scope().Parent().Parent())
+	}
+
+	if core.FormatEvent(parsed) != str {
+		t.Fatalf("Expected round trip to %s, got %s", str, core.FormatEvent(parsed))
+	}
+
+	// The unescaped names of the scopes are available
+	names, err := core.ScopeNames(parsed.Scope())
+	if err != nil || !reflect.DeepEqual(names, []string{"deploy/v1", "db:migrate"}) {
+		t.Fatalf("Unexpected scope names %v, %v", names, err)
+	}
+}
+
+func TestParseEvent_Invalid(t *testing.T) {
+	for _, invalid := range []string{"", "start", ":steps", "start:", "start:steps//child", "start:steps/100%"} {
+		if _, err := core.ParseEvent(invalid); err == nil {
+			t.Fatalf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	if err := core.ValidateName("migrate"); err != nil {
+		t.Fatalf("ValidateName returned an error: %v", err)
+	}
+
+	for _, invalid := range []string{"", "db:migrate", "deploy/validate", "100%"} {
+		if err := core.ValidateName(invalid); err == nil {
+			t.Fatalf("Expected an error for %q", invalid)
+		}
+	}
+}
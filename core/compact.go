@@ -0,0 +1,136 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// dictionaryKey is the state metadata key marking a compact state. It holds the fingerprint of the workflow
+// definition whose scope dictionary was used to encode the events.
+const dictionaryKey = "dictionary"
+
+// scopeDictionary assigns short ids to the scopes of the known events of a workflow definition.
+type scopeDictionary struct {
+	ids    map[string]string
+	scopes map[string]string
+}
+
+// newScopeDictionary assigns base 36 ids to the given scopes, in sorted order.
+func newScopeDictionary(scopes []string) scopeDictionary {
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	d := scopeDictionary{ids: make(map[string]string, len(scopes)), scopes: make(map[string]string, len(scopes))}
+	for i, scope := range scopes {
+		id := strconv.FormatInt(int64(i), 36)
+		d.ids[scope] = id
+		d.scopes[id] = scope
+	}
+
+	return d
+}
+
+// newDictionary returns the scope dictionary of the workflow definition, built from the scopes of its known events.
+// Scopes within the versions of versioned items are left out, so that adding a version does not change the ids,
+// see compactScope.
+func (sf *stepFlowImpl) newDictionary() scopeDictionary {
+	var scopes []string
+	for _, event := range sf.knownEvents() {
+		_, scope, _ := strings.Cut(event, eventSeparator)
+		if _, found := outermostVersionScope(sf.versionScopes, scope); !found {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return newScopeDictionary(scopes)
+}
+
+// compactScope returns the id of the given scope. Scopes within the versions of a versioned item are encoded
+// relative to the id of the item, e.g. "4/v2/validate".
+func (sf *stepFlowImpl) compactScope(scope string) (string, bool) {
+	versionScope, found := outermostVersionScope(sf.versionScopes, scope)
+	if !found {
+		id, found := sf.dictionary.ids[scope]
+		return id, found
+	}
+
+	itemScope, _ := cutLastScope(versionScope)
+	id, found := sf.dictionary.ids[itemScope]
+	return id + scopeSeparator + scope[len(itemScope)+len(scopeSeparator):], found
+}
+
+// expandScope returns the scope of the given id, see compactScope.
+func (sf *stepFlowImpl) expandScope(id string) (string, bool) {
+	id, relative, isVersion := strings.Cut(id, scopeSeparator)
+	scope, found := sf.dictionary.scopes[id]
+	if isVersion {
+		scope += scopeSeparator + relative
+	}
+
+	return scope, found
+}
+
+// cutLastScope cuts the given scope name around its last scope separator, returning the parent scope name and the name.
+func cutLastScope(scope string) (string, string) {
+	if i := strings.LastIndex(scope, scopeSeparator); i >= 0 {
+		return scope[:i], scope[i+len(scopeSeparator):]
+	}
+
+	return "", scope
+}
+
+// CompactState converts the events of the given state to their compact form, in which fully qualified scope names
+// are replaced with short ids, e.g. "completed:7" instead of "completed:release.v4/stepsRetry/validateWaitFor".
+// The state is marked with the definition fingerprint, which ExpandState requires to convert it back.
+func (sf *stepFlowImpl) CompactState(state State) (State, error) {
+	if _, found := state.Metadata[dictionaryKey]; found {
+		return state, nil
+	}
+
+	compact := state.Clone()
+	for i, event := range compact.Events {
+		name, scope, _ := strings.Cut(event, eventSeparator)
+		id, found := sf.compactScope(scope)
+		if !found {
+			return State{}, fmt.Errorf("cannot compact unknown event %s", event)
+		}
+
+		compact.Events[i] = name + eventSeparator + id
+	}
+
+	if len(compact.Events) > 0 {
+		compact.SetMetadata(dictionaryKey, sf.fingerprint)
+	}
+
+	return compact, nil
+}
+
+// ExpandState converts a state returned by CompactState back to its readable form.
+// States that are not compact are returned unchanged.
+func (sf *stepFlowImpl) ExpandState(state State) (State, error) {
+	fingerprint, found := state.Metadata[dictionaryKey]
+	if !found {
+		return state, nil
+	}
+
+	if fingerprint != sf.fingerprint {
+		return State{}, fmt.Errorf("%w: compact state dictionary %s, expected %s", ErrFingerprintMismatch, fingerprint, sf.fingerprint)
+	}
+
+	expanded := state.Clone()
+	delete(expanded.Metadata, dictionaryKey)
+	for i, event := range expanded.Events {
+		name, id, _ := strings.Cut(event, eventSeparator)
+		scope, found := sf.expandScope(id)
+		if !found {
+			return State{}, fmt.Errorf("cannot expand unknown compact event %s", event)
+		}
+
+		expanded.Events[i] = name + eventSeparator + scope
+	}
+
+	return expanded, nil
+}
@@ -0,0 +1,72 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestCompactState(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	items := []core.StepFlowItem{
+		core.NewFuncItem("prepare", noop),
+		core.NewRetryItem(core.NewStepsItem("stepsRetry", []core.StepFlowItem{core.NewFuncItem("validate", noop)}),
+			func(ctx context.Context, err error) (bool, error) { return false, nil }),
+	}
+
+	sf, err := core.NewStepFlow(core.NewStepsItem("release.v4", items), core.WithCompactState(true))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	// Compact and expand a state
+	state := core.StateFromStrings([]string{"completed:release.v4/stepsRetry/validate"})
+	compact, err := sf.CompactState(state)
+	if err != nil {
+		t.Fatalf("CompactState returned an error: %v", err)
+	}
+
+	if strings.Contains(compact.Events[0], "release.v4") {
+		t.Fatalf("Expected a compact event, got %s", compact.Events[0])
+	}
+
+	expanded, err := sf.ExpandState(compact)
+	if err != nil {
+		t.Fatalf("ExpandState returned an error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expanded.Events, state.Events) || len(expanded.Metadata) != 0 {
+		t.Fatalf("Expected state %+v, got %+v", state, expanded)
+	}
+
+	// Apply returns compact states until completion
+	var events []string
+	for range 5 {
+		events, err = sf.Apply(context.Background(), events)
+		if err != nil {
+			t.Fatalf("Apply returned an error: %v", err)
+		}
+
+		if strings.Contains(events[0], "release.v4") {
+			t.Fatalf("Expected a compact event, got %s", events[0])
+		}
+	}
+
+	if !sf.IsCompleted(events) {
+		t.Fatalf("Expected completed state, got %v", events)
+	}
+
+	// The dictionary of another definition cannot be used to expand the state
+	other, err := core.NewStepFlow(core.NewStepsItem("release.v4", items[:1]))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	if _, err := other.ExpandState(compact); !errors.Is(err, core.ErrFingerprintMismatch) {
+		t.Fatalf("Expected ErrFingerprintMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"context"
+	"slices"
+)
+
+// continueAsNewItem represents a workflow item that starts the workflow instance again from the root start command,
+// as a new run that keeps only the chosen variables.
+type continueAsNewItem struct {
+	scope    Scope
+	keepVars []string
+}
+
+// NewContinueAsNewItem creates a new workflow item that starts the workflow instance again from the root start command.
+// The new run keeps the given variables and the typed workflow data. The history, the step outputs, the other
+// variables, the versions chosen by versioned items, and the deadline and failure metadata are reset,
+// so long-running loops do not grow the state without bound.
+func NewContinueAsNewItem(name string, keepVars ...string) StepFlowItem {
+	return &continueAsNewItem{scope: NewScope(name), keepVars: keepVars}
+}
+
+// Transitions implements the StepFlowItem interface.
+// It defines a single exclusive transition from start to the root start command.
+func (ci *continueAsNewItem) Transitions(parent Scope) (Scope, []Transition, error) {
+	scope := WithParent(ci.scope, parent)
+	root := StartCommand(rootScope(scope))
+
+	destinationFunc := func(ctx context.Context) ([]Event, error) {
+		requestContinueAsNew(ctx, ci.keepVars)
+		return []Event{root}, nil
+	}
+
+	transitions := []Transition{
+		NewDynamicTransition(StartCommand(scope), destinationFunc, []PossibleDestination{
+			NewReason(root, "continue as new"),
+		}),
+	}
+
+	return scope, transitions, nil
+}
+
+// continueAsNewRequest holds the continue-as-new request of a workflow instance during an Apply call.
+type continueAsNewRequest struct {
+	requested bool
+	keepVars  []string
+}
+
+// continueAsNewContextKey is the context key used to make the continue-as-new request available to transitions.
+type continueAsNewContextKey struct{}
+
+// withContinueAsNewRequest returns a copy of ctx that carries an empty continue-as-new request.
+func withContinueAsNewRequest(ctx context.Context) (context.Context, *continueAsNewRequest) {
+	request := &continueAsNewRequest{}
+	return context.WithValue(ctx, continueAsNewContextKey{}, request), request
+}
+
+// requestContinueAsNew requests a new run of the workflow instance that keeps the given variables.
+func requestContinueAsNew(ctx context.Context, keepVars []string) {
+	if request, ok := ctx.Value(continueAsNewContextKey{}).(*continueAsNewRequest); ok {
+		request.requested = true
+		request.keepVars = keepVars
+	}
+}
+
+// continueAsNew resets the history, the variables that are not kept, the given stores, e.g. the step outputs,
+// and the deadline and failure metadata, once a new run has been requested.
+func (r *continueAsNewRequest) continueAsNew(ctx context.Context, metadata map[string]string, vars *Variables, history *history, stores ...*Variables) {
+	if !r.requested {
+		return
+	}
+	r.requested = false
+
+	for _, name := range vars.Names() {
+		if !slices.Contains(r.keepVars, name) {
+			vars.Delete(name)
+		}
+	}
+
+	for _, store := range stores {
+		for _, name := range store.Names() {
+			store.Delete(name)
+		}
+	}
+
+	history.reset()
+	clearFailure(ctx)
+	for _, key := range []string{startedAtKey, deadlineExceededAtKey, failedScopeKey, failureKey} {
+		delete(metadata, key)
+	}
+}
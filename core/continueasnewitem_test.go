@@ -0,0 +1,68 @@
+package core_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestContinueAsNewItem(t *testing.T) {
+	// Create a reconcile loop that never completes
+	item := core.NewStepsItem("reconcile", []core.StepFlowItem{
+		core.NewFuncItem("observe", func(ctx context.Context) error {
+			var generation int
+			if _, err := core.Vars(ctx).Get("generation", &generation); err != nil {
+				return err
+			}
+
+			if err := core.Outputs(ctx).Set("observe", generation); err != nil {
+				return err
+			}
+
+			if err := core.Vars(ctx).Set("scratch", generation); err != nil {
+				return err
+			}
+			return core.Vars(ctx).Set("generation", generation+1)
+		}),
+		core.NewContinueAsNewItem("restart", "generation"),
+	})
+
+	sf, err := core.NewStepFlow(item, core.WithHistory(100))
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	var state core.State
+	for range 3 {
+		// Observe
+		state, err = sf.ApplyState(context.Background(), state)
+		if err != nil {
+			t.Fatalf("ApplyState returned an error: %v", err)
+		}
+
+		// Continue as new
+		state, err = sf.ApplyState(context.Background(), state)
+		if err != nil {
+			t.Fatalf("ApplyState returned an error: %v", err)
+		}
+
+		if !reflect.DeepEqual(state.Events, []string{"start:reconcile"}) {
+			t.Fatalf("Expected the root start command, got %v", state.Events)
+		}
+	}
+
+	// Only the kept variables remain, and the history and outputs are reset
+	if string(state.Data["vars"]) != `{"generation":3}` {
+		t.Fatalf("Unexpected variables %s", state.Data["vars"])
+	}
+
+	if _, found := state.Data["outputs"]; found {
+		t.Fatalf("Expected no outputs, got %s", state.Data["outputs"])
+	}
+
+	if _, found := state.Data["history"]; found {
+		t.Fatalf("Expected no history, got %s", state.Data["history"])
+	}
+}
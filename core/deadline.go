@@ -0,0 +1,49 @@
+package core
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDeadlineExceeded is returned by StepFlow.Apply once a workflow instance has reached the terminal timed-out state.
+var ErrDeadlineExceeded = errors.New("workflow deadline exceeded")
+
+const (
+	// startedAtKey is the state metadata key holding the time at which the instance left the start state.
+	startedAtKey = "startedAt"
+
+	// deadlineExceededAtKey is the state metadata key holding the time at which the deadline was found exceeded.
+	deadlineExceededAtKey = "deadlineExceededAt"
+)
+
+// applyDeadline records the start time of the instance and, once the deadline has passed, routes
+// the instance to the deadline handler or to the timed-out state. It returns the events to continue with.
+func (sf *stepFlowImpl) applyDeadline(events []string, metadata map[string]string) []string {
+	if sf.options.deadline <= 0 {
+		return events
+	}
+
+	now := sf.options.now().UTC()
+
+	startedAt, err := time.Parse(time.RFC3339Nano, metadata[startedAtKey])
+	if err != nil {
+		startedAt = now
+		metadata[startedAtKey] = startedAt.Format(time.RFC3339Nano)
+	}
+
+	if _, found := metadata[deadlineExceededAtKey]; found || now.Sub(startedAt) < sf.options.deadline {
+		return events
+	}
+
+	if sf.isFinal(events) {
+		return events
+	}
+
+	metadata[deadlineExceededAtKey] = now.Format(time.RFC3339Nano)
+
+	if sf.handlerScope == nil {
+		return sf.timedOutState
+	}
+
+	return []string{eventString(StartCommand(sf.handlerScope))}
+}
@@ -0,0 +1,157 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestStepFlow_Apply_DeadlineHandler(t *testing.T) {
+	// Use a fake clock
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	// Keep track of executed steps
+	executed := make(map[string]bool)
+
+	item := core.NewStepsItem("process", []core.StepFlowItem{
+		core.NewWaitForItem("approval", func(ctx context.Context) (bool, error) {
+			return false, nil
+		}),
+	})
+
+	handler := core.NewStepsItem("onDeadline", []core.StepFlowItem{
+		core.NewFuncItem("notify", func(ctx context.Context) error {
+			executed["notify"] = true
+			return nil
+		}),
+	})
+
+	sf, err := core.NewStepFlow(item, core.WithDeadline(time.Hour, handler), core.WithClock(clock))
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// The first Apply records the start time in the state
+	state, err := sf.Apply(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Apply returned an error: %v", err)
+	}
+
+	expectedState := "[start:process/approval @startedAt=2026-01-01T00:00:00Z]"
+	if fmt.Sprintf("%s", state) != expectedState {
+		t.Fatalf("Expected state %s, got %s", expectedState, state)
+	}
+
+	// Before the deadline, the instance keeps waiting
+	now = now.Add(30 * time.Minute)
+	state, err = sf.Apply(context.Background(), state)
+	if err != nil {
+		t.Fatalf("Apply returned an error: %v", err)
+	}
+
+	if !strings.HasPrefix(fmt.Sprintf("%s", state), "[start:process/approval ") {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	// After the deadline, the instance runs the handler
+	now = now.Add(time.Hour)
+	state, err = sf.Apply(context.Background(), state)
+	if err != nil {
+		t.Fatalf("Apply returned an error: %v", err)
+	}
+
+	if !executed["notify"] {
+		t.Fatal("Deadline handler was not executed")
+	}
+
+	// Once the handler completes, the instance moves to the timed-out state
+	state, err = sf.Apply(context.Background(), state)
+	if !errors.Is(err, core.ErrDeadlineExceeded) {
+		t.Fatalf("Expected error %v, got %v", core.ErrDeadlineExceeded, err)
+	}
+
+	if state[0] != "timedOut:process" {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	if sf.IsCompleted(state) {
+		t.Fatal("Timed out step flow should not be completed")
+	}
+
+	// The timed-out state is terminal
+	_, err = sf.Apply(context.Background(), state)
+	if !errors.Is(err, core.ErrDeadlineExceeded) {
+		t.Fatalf("Expected error %v, got %v", core.ErrDeadlineExceeded, err)
+	}
+}
+
+func TestStepFlow_Apply_DeadlineWithoutHandler(t *testing.T) {
+	// Use a fake clock
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	item := core.NewWaitForItem("approval", func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+
+	sf, err := core.NewStepFlow(item, core.WithDeadline(time.Minute, nil), core.WithClock(clock))
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	state, err := sf.Apply(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Apply returned an error: %v", err)
+	}
+
+	// After the deadline, the instance moves directly to the timed-out state
+	now = now.Add(2 * time.Minute)
+	state, err = sf.Apply(context.Background(), state)
+	if !errors.Is(err, core.ErrDeadlineExceeded) {
+		t.Fatalf("Expected error %v, got %v", core.ErrDeadlineExceeded, err)
+	}
+
+	expectedState := "[timedOut:approval @deadlineExceededAt=2026-01-01T00:02:00Z @startedAt=2026-01-01T00:00:00Z]"
+	if fmt.Sprintf("%s", state) != expectedState {
+		t.Fatalf("Expected state %s, got %s", expectedState, state)
+	}
+}
+
+func TestStepFlow_Apply_CompletedBeforeDeadline(t *testing.T) {
+	// Create a step flow that completes right away
+	item := core.NewFuncItem("test", func(ctx context.Context) error {
+		return nil
+	})
+
+	sf, err := core.NewStepFlow(item, core.WithDeadline(time.Hour, nil))
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	state, err := sf.Apply(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Apply returned an error: %v", err)
+	}
+
+	// The start time metadata does not prevent the completion check
+	if !sf.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+}
+
+func TestStepFlow_DeadlineHandlerNameConflict(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	item := core.NewStepsItem("deploy", []core.StepFlowItem{core.NewFuncItem("onDeadline", noop)})
+	handler := core.NewStepsItem("onDeadline", []core.StepFlowItem{core.NewFuncItem("notify", noop)})
+
+	_, err := core.NewStepFlow(item, core.WithDeadline(time.Hour, handler))
+	if err == nil || !strings.Contains(err.Error(), "deadline handler deploy/onDeadline conflicts") {
+		t.Fatalf("Expected a deadline handler conflict, got %v", err)
+	}
+}
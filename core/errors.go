@@ -0,0 +1,102 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// TransitionKind describes how a transition computes its destination.
+type TransitionKind string
+
+const (
+	// StaticTransitionKind identifies transitions that always move to predetermined destination events.
+	StaticTransitionKind TransitionKind = "static"
+
+	// DynamicTransitionKind identifies transitions that evaluate a function to determine their destination events.
+	DynamicTransitionKind TransitionKind = "dynamic"
+)
+
+// kindOf returns the kind of the given transition.
+// Transitions that are not known to this package are classified based on their exclusivity.
+func kindOf(t Transition) TransitionKind {
+	switch t := t.(type) {
+	case *staticTransition:
+		return StaticTransitionKind
+	case *dynamicTransition:
+		return DynamicTransitionKind
+	case *retriableTransition:
+		return kindOf(t.transition)
+	case *circuitBreakerTransition:
+		return kindOf(t.transition)
+	case *errorRoutingTransition:
+		return kindOf(t.transition)
+	case *versionedTransition:
+		return kindOf(t.Transition)
+	}
+
+	if t.IsExclusive() {
+		return DynamicTransitionKind
+	}
+
+	return StaticTransitionKind
+}
+
+// StepError is returned by StepFlow.Apply when a transition fails.
+// It identifies the step that failed and wraps the original error.
+type StepError struct {
+	// Scope is the fully qualified name of the failing step scope, e.g. "deploy/stepsRetry/validate".
+	Scope string
+
+	// Event is the string representation of the source event of the failing transition.
+	Event string
+
+	// Kind is the kind of the failing transition.
+	Kind TransitionKind
+
+	// Attempt counts the consecutive failures of the source event, starting at 1. Failures handled by Retry
+	// or OnError items are counted, within a single Apply call or, with WithAttempts, across Apply calls.
+	Attempt int
+
+	// Err is the original error.
+	Err error
+}
+
+// newStepError creates a new StepError for the given transition.
+func newStepError(t Transition, attempt int, err error) *StepError {
+	return &StepError{
+		Scope:   t.Source().Scope().Name(),
+		Event:   eventString(t.Source()),
+		Kind:    kindOf(t),
+		Attempt: attempt,
+		Err:     err,
+	}
+}
+
+// Error implements the error interface.
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %s failed on %s (%s transition, attempt %d): %v", e.Scope, e.Event, e.Kind, e.Attempt, e.Err)
+}
+
+// Unwrap returns the original error.
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// StepTimeoutError is returned when a step function does not complete within its own timeout.
+type StepTimeoutError struct {
+	// Timeout is the timeout configured for the step.
+	Timeout time.Duration
+
+	// Err is the error returned by the step function.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *StepTimeoutError) Error() string {
+	return fmt.Sprintf("step timed out after %s: %v", e.Timeout, e.Err)
+}
+
+// Unwrap returns the error returned by the step function.
+func (e *StepTimeoutError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FailedEvent creates a "failed" event for the given scope.
+func FailedEvent(scope Scope) Event {
+	return NewEvent("failed", scope)
+}
+
+// reRaiseFailure creates a transition that re-raises the failure of the given child scope to its parent scope.
+func reRaiseFailure(childScope Scope) Transition {
+	return NewStaticTransition(FailedEvent(childScope), FailedEvent(childScope.Parent()))
+}
+
+// isFailedState checks if all the given events are failed events.
+func isFailedState(events []string) bool {
+	if len(events) == 0 {
+		return false
+	}
+
+	for _, event := range events {
+		if !strings.HasPrefix(event, "failed:") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsEvent checks if the given events contain an event equal to the given one.
+func containsEvent(events []Event, event Event) bool {
+	for _, e := range events {
+		if eventString(e) == eventString(event) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FailureError describes a step failure recorded in the state when failure events are enabled.
+type FailureError struct {
+	// Scope is the fully qualified name of the scope of the failing step.
+	Scope string
+
+	// Message is the message of the original error.
+	Message string
+
+	// Err is the original error. It is only available in the Apply call in which the failure occurred.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *FailureError) Error() string {
+	return fmt.Sprintf("step %s failed: %s", e.Scope, e.Message)
+}
+
+// Unwrap returns the original error, if available.
+func (e *FailureError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	// failedScopeKey is the state metadata key holding the scope of the last unhandled failure.
+	failedScopeKey = "failedScope"
+
+	// failureKey is the state metadata key holding the message of the last unhandled failure.
+	// When a cipher is configured, the message is held by the state data key of the same name, so it is encrypted.
+	failureKey = "failure"
+)
+
+// failureRecorder holds the unhandled failure of a workflow instance during an Apply call.
+type failureRecorder struct {
+	failure *FailureError
+
+	// handled is the message of the last error handled by a Retry or OnError item, until it is recorded in the history.
+	handled string
+}
+
+// failureRecorderContextKey is the context key used to make the failure recorder available to transitions.
+type failureRecorderContextKey struct{}
+
+// withFailureRecorder returns a copy of ctx that carries a failure recorder initialized from the state.
+func withFailureRecorder(ctx context.Context, state State) (context.Context, *failureRecorder, error) {
+	recorder := &failureRecorder{}
+	if message, found := state.Metadata[failureKey]; found {
+		recorder.failure = &FailureError{Scope: state.Metadata[failedScopeKey], Message: message}
+	}
+
+	if data, found := state.Data[failureKey]; found {
+		recorder.failure = &FailureError{Scope: state.Metadata[failedScopeKey]}
+		if err := json.Unmarshal(data, &recorder.failure.Message); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return context.WithValue(ctx, failureRecorderContextKey{}, recorder), recorder, nil
+}
+
+// recordFailure records err as the unhandled failure of the given scope.
+func recordFailure(ctx context.Context, scope Scope, err error) {
+	if recorder, ok := ctx.Value(failureRecorderContextKey{}).(*failureRecorder); ok {
+		recorder.failure = &FailureError{Scope: scope.Name(), Message: err.Error(), Err: err}
+	}
+}
+
+// currentFailure returns the unhandled failure, or a generic failure of the given scope if none was recorded.
+func currentFailure(ctx context.Context, scope Scope) error {
+	if recorder, ok := ctx.Value(failureRecorderContextKey{}).(*failureRecorder); ok && recorder.failure != nil {
+		return recorder.failure
+	}
+
+	return &FailureError{Scope: scope.Name(), Message: "unknown failure"}
+}
+
+// clearFailure clears the unhandled failure, once it has been handled.
+func clearFailure(ctx context.Context) {
+	if recorder, ok := ctx.Value(failureRecorderContextKey{}).(*failureRecorder); ok {
+		recorder.failure = nil
+	}
+}
+
+// recordHandledFailure records the message of err, once handled by a Retry or OnError item, for the history entry
+// of the transition being applied.
+func recordHandledFailure(ctx context.Context, err error) {
+	if recorder, ok := ctx.Value(failureRecorderContextKey{}).(*failureRecorder); ok {
+		recorder.handled = err.Error()
+		if failure, ok := err.(*FailureError); ok {
+			recorder.handled = failure.Message
+		}
+	}
+}
+
+// takeHandledFailure returns and clears the message of the last handled error, if any.
+func takeHandledFailure(ctx context.Context) string {
+	recorder, ok := ctx.Value(failureRecorderContextKey{}).(*failureRecorder)
+	if !ok {
+		return ""
+	}
+
+	handled := recorder.handled
+	recorder.handled = ""
+	return handled
+}
+
+// save stores the unhandled failure, if any, in the state. The message is stored in the state data if inData is true,
+// e.g. to encrypt it along with the data, and in the metadata otherwise.
+func (fr *failureRecorder) save(state *State, inData bool) error {
+	delete(state.Metadata, failedScopeKey)
+	delete(state.Metadata, failureKey)
+	delete(state.Data, failureKey)
+	if fr.failure == nil {
+		return nil
+	}
+
+	state.Metadata[failedScopeKey] = fr.failure.Scope
+	if !inData {
+		state.Metadata[failureKey] = fr.failure.Message
+		return nil
+	}
+
+	data, err := json.Marshal(fr.failure.Message)
+	if err != nil {
+		return err
+	}
+
+	state.SetData(failureKey, data)
+	return nil
+}
@@ -0,0 +1,151 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestStepFlow_Apply_FailureEvents(t *testing.T) {
+	// Create a nested step flow with a failing function item
+	expectedErr := errors.New("test error")
+	item := core.NewStepsItem("deploy", []core.StepFlowItem{
+		core.NewCaseItem("validateCase", core.NewStepsItem("steps", []core.StepFlowItem{
+			core.NewFuncItem("validate", func(ctx context.Context) error {
+				return expectedErr
+			}),
+		}), func(ctx context.Context) (bool, error) {
+			return true, nil
+		}),
+	})
+
+	sf, err := core.NewStepFlow(item, core.WithFailureEvents(true))
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Apply the step flow until the failure reaches the root
+	var state []string
+	for range 2 {
+		state, err = sf.Apply(context.Background(), state)
+		if err != nil {
+			break
+		}
+	}
+
+	// Check that the original error is returned
+	var failureErr *core.FailureError
+	if !errors.As(err, &failureErr) {
+		t.Fatalf("Expected *core.FailureError, got %v", err)
+	}
+
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("Expected error %v, got %v", expectedErr, err)
+	}
+
+	// Check that the failure is part of the state
+	expectedState := "[failed:deploy @failedScope=deploy/validateCase/steps/validate @failure=test error]"
+	if fmt.Sprintf("%s", state) != expectedState {
+		t.Fatalf("Expected state %s, got %s", expectedState, state)
+	}
+
+	// The failed state is terminal and the failure is restored from the state
+	_, err = sf.Apply(context.Background(), state)
+	if !errors.As(err, &failureErr) {
+		t.Fatalf("Expected *core.FailureError, got %v", err)
+	}
+
+	if failureErr.Scope != "deploy/validateCase/steps/validate" || failureErr.Message != "test error" {
+		t.Fatalf("Unexpected failure %+v", failureErr)
+	}
+}
+
+func TestStepFlow_Apply_FailureEventsRetried(t *testing.T) {
+	// Track calls
+	callCount := 0
+	expectedErr := errors.New("first attempt error")
+
+	// Create a retry item wrapping steps that fail on the first attempt
+	item := core.NewRetryItem(core.NewStepsItem("stepsRetry", []core.StepFlowItem{
+		core.NewFuncItem("child", func(ctx context.Context) error {
+			callCount++
+			if callCount == 1 {
+				return expectedErr
+			}
+			return nil
+		}),
+	}), func(ctx context.Context, err error) (bool, error) {
+		// The handler receives the original error
+		return errors.Is(err, expectedErr), nil
+	})
+
+	sf, err := core.NewStepFlow(item, core.WithFailureEvents(true))
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// The failure is handled within the first Apply call
+	state, err := sf.Apply(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Apply returned an error: %v", err)
+	}
+
+	// The failure is only counted in the state with WithAttempts
+	if fmt.Sprintf("%s", state) != `[start:stepsRetry]` {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	for range 2 {
+		state, err = sf.Apply(context.Background(), state)
+		if err != nil {
+			t.Fatalf("Apply returned an error: %v", err)
+		}
+	}
+
+	// stepflow should have been completed after the expected number of iterations.
+	if !sf.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	if callCount != 2 {
+		t.Fatalf("Expected function to be called 2 times, got %d", callCount)
+	}
+}
+
+func TestReRaiseFailureTransitions(t *testing.T) {
+	// Create a loop with a child
+	child := core.NewFuncItem("child", func(ctx context.Context) error {
+		return nil
+	})
+
+	item := core.NewLoopUntilItem("loop", child, func(ctx context.Context) (bool, error) {
+		return true, nil
+	})
+
+	// Get transitions
+	scope, transitions, err := item.Transitions(core.NewScope("parent"))
+	if err != nil {
+		t.Fatalf("Transitions returned an error: %v", err)
+	}
+
+	// The child failure is re-raised to the loop scope
+	found := false
+	for _, transition := range transitions {
+		if transition.Source().Name() != "failed" {
+			continue
+		}
+
+		destinations, _ := transition.Destination(context.Background())
+		if transition.Source().Scope().Parent() == scope &&
+			destinations[0].Name() == "failed" && destinations[0].Scope().Name() == "parent/loop" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("Expected a transition re-raising the child failure to the loop")
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrFingerprintMismatch is returned by StepFlow.Apply for states produced by an incompatible workflow definition.
+var ErrFingerprintMismatch = errors.New("state fingerprint does not match the workflow definition")
+
+// fingerprintKey is the state metadata key holding the fingerprint of the workflow definition that produced the state.
+const fingerprintKey = "fingerprint"
+
+// fingerprint computes a stable fingerprint of the given transitions from their sources, kinds and possible destinations.
+// Only the transitions of the given version scope are covered, or the transitions outside of any version scope
+// if it is empty. The destinations within the version scopes nested in it are ignored, see NewVersionedItem.
+func fingerprint(transitionsMap map[string][]Transition, versionScopes []string, versionScope string) string {
+	var sources []string
+	for source := range transitionsMap {
+		if innermostVersionScope(versionScopes, transitionsMap[source][0].Source().Scope().Name()) == versionScope {
+			sources = append(sources, source)
+		}
+	}
+	slices.Sort(sources)
+
+	h := sha256.New()
+	for _, source := range sources {
+		for _, t := range transitionsMap[source] {
+			_, _ = fmt.Fprintf(h, "%s %s %t\n", source, kindOf(t), t.IsExclusive())
+			for _, destination := range t.PossibleDestinations() {
+				if isNestedVersionEvent(versionScopes, versionScope, destination.Event()) {
+					continue
+				}
+
+				_, _ = fmt.Fprintf(h, "\t%s %s\n", eventString(destination.Event()), destination.Reason())
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// isNestedVersionEvent checks if the scope of the given event is within a version scope nested in the given version
+// scope, or within any version scope if it is empty.
+func isNestedVersionEvent(versionScopes []string, versionScope string, event Event) bool {
+	innermost := innermostVersionScope(versionScopes, event.Scope().Name())
+	return innermost != "" && innermost != versionScope && (versionScope == "" || isSameOrParentScope(versionScope, innermost))
+}
+
+// versionFingerprints computes the fingerprint of each version of the versioned items of the given transitions,
+// keyed by the scope of the versioned item and by version.
+func versionFingerprints(transitionsMap map[string][]Transition, versionScopes []string) map[string]map[int]string {
+	result := make(map[string]map[int]string)
+	for _, transitions := range transitionsMap {
+		for _, t := range transitions {
+			for version, scope := range versionsOf(t) {
+				itemScope := t.Source().Scope().Name()
+				if result[itemScope] == nil {
+					result[itemScope] = make(map[int]string)
+				}
+				result[itemScope][version] = fingerprint(transitionsMap, versionScopes, scope.Name())
+			}
+		}
+	}
+
+	return result
+}
+
+// Fingerprint returns a stable fingerprint of the workflow definition, computed from its scopes,
+// transitions and possible destinations. The versions of versioned items are fingerprinted separately.
+func (sf *stepFlowImpl) Fingerprint() string {
+	return sf.fingerprint
+}
+
+// checkFingerprint returns an error if the state metadata holds the fingerprint of another workflow definition.
+func (sf *stepFlowImpl) checkFingerprint(metadata map[string]string) error {
+	if stateFingerprint, found := metadata[fingerprintKey]; found && stateFingerprint != sf.fingerprint {
+		return fmt.Errorf("%w: got %s, expected %s", ErrFingerprintMismatch, stateFingerprint, sf.fingerprint)
+	}
+
+	return nil
+}
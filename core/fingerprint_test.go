@@ -0,0 +1,54 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestFingerprint(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	newFlow := func(items ...core.StepFlowItem) core.StepFlow {
+		sf, err := core.NewStepFlow(core.NewStepsItem("deploy", items), core.WithFingerprint(true))
+		if err != nil {
+			t.Fatalf("Failed to create step flow: %v", err)
+		}
+
+		return sf
+	}
+
+	// The fingerprint is stable
+	sf := newFlow(core.NewFuncItem("prepare", noop), core.NewFuncItem("deploy", noop))
+	if sf.Fingerprint() != newFlow(core.NewFuncItem("prepare", noop), core.NewFuncItem("deploy", noop)).Fingerprint() {
+		t.Fatal("Expected the same fingerprint for the same definition")
+	}
+
+	// Reordering steps changes the fingerprint, even though the event names still match
+	reordered := newFlow(core.NewFuncItem("deploy", noop), core.NewFuncItem("prepare", noop))
+	if sf.Fingerprint() == reordered.Fingerprint() {
+		t.Fatal("Expected a different fingerprint for a different definition")
+	}
+
+	// The fingerprint is written into the state
+	state, err := sf.ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	if state.Metadata["fingerprint"] != sf.Fingerprint() {
+		t.Fatalf("Expected fingerprint %s in the state, got %v", sf.Fingerprint(), state.Metadata)
+	}
+
+	// States of an incompatible definition are refused
+	_, err = reordered.ApplyState(context.Background(), state)
+	if !errors.Is(err, core.ErrFingerprintMismatch) {
+		t.Fatalf("Expected ErrFingerprintMismatch, got %v", err)
+	}
+
+	diagnostics := reordered.ValidateState(state)
+	if len(diagnostics) != 1 || diagnostics[0].Kind != core.FingerprintMismatchDiagnostic {
+		t.Fatalf("Expected a single fingerprint mismatch diagnostic, got %v", diagnostics)
+	}
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// historyKey is the state data key holding the execution history.
+const historyKey = "history"
+
+// HistoryEntry records a transition applied to a workflow instance, see WithHistory.
+type HistoryEntry struct {
+	// Source is the source event of the transition.
+	Source string `json:"source"`
+
+	// Destinations are the destination events of the transition.
+	Destinations []string `json:"destinations"`
+
+	// Reason is the reason of the possible destination taken, e.g. "Case condition is met".
+	// It is empty when the destination is not one of the possible destinations, e.g. a failed event.
+	Reason string `json:"reason,omitempty"`
+
+	// Time is the time at which the transition was applied.
+	Time time.Time `json:"time"`
+
+	// Error is the message of the step failure, when the transition failed with failure events enabled,
+	// or when the failure was handled by a Retry or OnError item.
+	Error string `json:"error,omitempty"`
+}
+
+// HistoryFromState returns the execution history recorded in the given state, oldest entry first.
+// The history of states encrypted with WithCipher is read with StepFlow.History instead.
+func HistoryFromState(state State) ([]HistoryEntry, error) {
+	if _, found := state.Data[encryptedKey]; found {
+		return nil, errors.New("state data is encrypted, read the history with StepFlow.History")
+	}
+
+	var entries []HistoryEntry
+	if data, found := state.Data[historyKey]; found {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// History returns the execution history recorded in the given state, oldest entry first, like HistoryFromState.
+// The state is verified like in ApplyState and its data is decrypted first, if a cipher is configured.
+func (sf *stepFlowImpl) History(state State) ([]HistoryEntry, error) {
+	if err := checkStateVersion(state.Version); err != nil {
+		return nil, err
+	}
+
+	if err := sf.verifyState(state); err != nil {
+		return nil, err
+	}
+
+	if err := sf.checkFingerprint(state.Metadata); err != nil {
+		return nil, err
+	}
+
+	expanded, err := sf.ExpandState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded = expanded.Clone()
+	if err := sf.decryptData(&expanded); err != nil {
+		return nil, err
+	}
+
+	return HistoryFromState(expanded)
+}
+
+// history holds the execution history of a workflow instance during an Apply call.
+type history struct {
+	maxEntries int
+	now        func() time.Time
+	entries    []HistoryEntry
+}
+
+// newHistory returns the history decoded from the state, or nil if the history is disabled.
+func newHistory(state State, o options) (*history, error) {
+	if o.historyMaxEntries <= 0 {
+		return nil, nil
+	}
+
+	entries, err := HistoryFromState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	return &history{maxEntries: o.historyMaxEntries, now: o.now, entries: entries}, nil
+}
+
+// record appends an entry for the given applied transition, dropping the oldest entries beyond the retention cap.
+func (h *history) record(ctx context.Context, t Transition, destinations []Event) {
+	if h == nil {
+		return
+	}
+
+	entry := HistoryEntry{Source: eventString(t.Source()), Destinations: eventsString(destinations), Time: h.now().UTC()}
+	if len(destinations) > 0 {
+		for _, possibleDestination := range t.PossibleDestinations() {
+			if eventString(possibleDestination.Event()) == entry.Destinations[0] {
+				entry.Reason = possibleDestination.Reason()
+				break
+			}
+		}
+	}
+
+	entry.Error = takeHandledFailure(ctx)
+	if containsEvent(destinations, FailedEvent(t.Source().Scope())) {
+		if failure, ok := currentFailure(ctx, t.Source().Scope()).(*FailureError); ok {
+			entry.Error = failure.Message
+		}
+	}
+
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > h.maxEntries {
+		h.entries = h.entries[len(h.entries)-h.maxEntries:]
+	}
+}
+
+// reset removes all the entries.
+func (h *history) reset() {
+	if h == nil {
+		return
+	}
+
+	h.entries = nil
+}
+
+// save stores the entries in the state data.
+func (h *history) save(state *State) error {
+	if h == nil {
+		return nil
+	}
+
+	if len(h.entries) == 0 {
+		delete(state.Data, historyKey)
+		return nil
+	}
+
+	data, err := json.Marshal(h.entries)
+	if err != nil {
+		return err
+	}
+
+	state.SetData(historyKey, data)
+	return nil
+}
@@ -0,0 +1,115 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestHistory(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sf, err := core.NewStepFlow(core.NewStepsItem("deploy", []core.StepFlowItem{
+		core.NewCaseItem("canaryCase", core.NewFuncItem("canary", noop), func(ctx context.Context) (bool, error) {
+			return false, nil
+		}),
+		core.NewFuncItem("deploy", func(ctx context.Context) error { return errors.New("quota exceeded") }),
+	}), core.WithHistory(3), core.WithFailureEvents(true), core.WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	// Apply until the deploy step fails
+	state, err := sf.ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	entries, err := core.HistoryFromState(state)
+	if err != nil {
+		t.Fatalf("HistoryFromState returned an error: %v", err)
+	}
+
+	// start:deploy -> start:deploy/canaryCase, then the case condition
+	if len(entries) != 2 || entries[1].Source != "start:deploy/canaryCase" || entries[1].Reason != "Case condition is not met" {
+		t.Fatalf("Unexpected history %+v", entries)
+	}
+
+	if !entries[1].Time.Equal(now) {
+		t.Fatalf("Expected time %s, got %s", now, entries[1].Time)
+	}
+
+	// The failed state is returned along with the failure
+	state, err = sf.ApplyState(context.Background(), state)
+	var failureErr *core.FailureError
+	if !errors.As(err, &failureErr) {
+		t.Fatalf("Expected a *FailureError, got %v", err)
+	}
+
+	entries, err = core.HistoryFromState(state)
+	if err != nil {
+		t.Fatalf("HistoryFromState returned an error: %v", err)
+	}
+
+	// Only the last 3 entries are kept, the last one being the re-raised failure
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 history entries, got %+v", entries)
+	}
+
+	if entries[1].Source != "start:deploy/deploy" || entries[1].Error != "quota exceeded" {
+		t.Fatalf("Expected the deploy failure in the history, got %+v", entries[1])
+	}
+}
+
+func TestHistory_HandledErrors(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	calls := 0
+	body := core.NewStepsItem("body", []core.StepFlowItem{
+		core.NewFuncItem("validate", func(ctx context.Context) error {
+			calls++
+			if calls == 1 {
+				return errors.New("connection refused")
+			}
+			return errors.New("quota exceeded")
+		}),
+	})
+
+	sf, err := core.NewStepFlow(core.NewStepsItem("deploy", []core.StepFlowItem{
+		core.NewOnErrorItem("quotaOnError", core.NewRetryItem(body, func(ctx context.Context, err error) (bool, error) {
+			return err.Error() == "connection refused", nil
+		}), func(err error) string { return "quota" }, map[string]core.RecoveryBranch{
+			"quota": {Item: core.NewFuncItem("notify", noop), ContinueAfter: true},
+		}),
+	}), core.WithHistory(10))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	state := core.State{}
+	for range 2 {
+		if state, err = sf.ApplyState(context.Background(), state); err != nil {
+			t.Fatalf("ApplyState returned an error: %v", err)
+		}
+	}
+
+	entries, err := core.HistoryFromState(state)
+	if err != nil {
+		t.Fatalf("HistoryFromState returned an error: %v", err)
+	}
+
+	var handled []string
+	for _, entry := range entries {
+		if entry.Error != "" {
+			handled = append(handled, entry.Reason+": "+entry.Error)
+		}
+	}
+
+	// The retried error and the error routed to the recovery branch are both recorded
+	if len(handled) != 2 || handled[0] != "retry: connection refused" || handled[1] != "OnError quota: quota exceeded" {
+		t.Fatalf("Unexpected handled errors %v in history %+v", handled, entries)
+	}
+}
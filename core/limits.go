@@ -0,0 +1,145 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// StateLimit identifies a limit on the state, see WithStateLimit.
+type StateLimit string
+
+const (
+	// EventsLimit limits the number of events in the state. Active events are never removed,
+	// so it only supports FailPolicy, with a maximum of at least 1.
+	EventsLimit StateLimit = "events"
+
+	// VariablesBytesLimit limits the size in bytes of the JSON encoded variables in the state.
+	VariablesBytesLimit StateLimit = "variablesBytes"
+
+	// HistoryLimit limits the number of history entries in the state. It requires WithHistory, which keeps
+	// the last maxEntries entries: the limit only takes effect when its maximum is lower than maxEntries.
+	HistoryLimit StateLimit = "history"
+)
+
+// LimitPolicy describes how Apply enforces an exceeded state limit.
+type LimitPolicy string
+
+const (
+	// FailPolicy makes Apply return a *StateLimitError together with the new state, which exceeds the limit.
+	// The step functions have already been called, so storing the new state keeps them from being called again.
+	FailPolicy LimitPolicy = "fail"
+
+	// TruncateOldestPolicy removes the oldest entries until the limit is met. It applies to history only,
+	// for which it lowers the number of entries kept by WithHistory.
+	TruncateOldestPolicy LimitPolicy = "truncateOldest"
+
+	// DropPolicy drops the newest entries beyond the limit. For variables, it drops the changes made in the Apply call.
+	// It applies to variables and history.
+	DropPolicy LimitPolicy = "drop"
+)
+
+// stateLimit holds the maximum and the policy of a state limit.
+type stateLimit struct {
+	max    int
+	policy LimitPolicy
+}
+
+// StateLimitError is returned by StepFlow.Apply when a state limit with FailPolicy is exceeded.
+type StateLimitError struct {
+	// Limit is the exceeded limit.
+	Limit StateLimit
+
+	// Max is the configured maximum.
+	Max int
+
+	// Actual is the value that exceeded the maximum.
+	Actual int
+}
+
+// Error implements the error interface.
+func (e *StateLimitError) Error() string {
+	return fmt.Sprintf("state limit %s exceeded: %d > %d", e.Limit, e.Actual, e.Max)
+}
+
+// checkStateLimits returns an error if a state limit is configured with an unsupported maximum or policy.
+func checkStateLimits(o options) error {
+	for limit, l := range o.limits {
+		if l.max < 0 {
+			return fmt.Errorf("state limit %s must not be negative", limit)
+		}
+
+		switch {
+		case limit != EventsLimit && limit != VariablesBytesLimit && limit != HistoryLimit:
+			return fmt.Errorf("unknown state limit %s", limit)
+		case l.policy != FailPolicy && l.policy != TruncateOldestPolicy && l.policy != DropPolicy:
+			return fmt.Errorf("unknown policy %s for state limit %s", l.policy, limit)
+		case limit == VariablesBytesLimit && l.policy == TruncateOldestPolicy,
+			limit == EventsLimit && l.policy != FailPolicy:
+			return fmt.Errorf("policy %s is not supported for state limit %s", l.policy, limit)
+		case limit == EventsLimit && l.max < 1:
+			return fmt.Errorf("state limit %s must be at least 1", limit)
+		case limit == HistoryLimit && o.historyMaxEntries <= 0:
+			return fmt.Errorf("state limit %s requires WithHistory", limit)
+		}
+	}
+
+	return nil
+}
+
+// checkLimit returns the given limit and whether the actual value exceeds it.
+// It returns a *StateLimitError if the limit is exceeded and its policy is FailPolicy.
+func (sf *stepFlowImpl) checkLimit(limit StateLimit, actual int) (stateLimit, bool, error) {
+	l, found := sf.options.limits[limit]
+	if !found || actual <= l.max {
+		return l, false, nil
+	}
+
+	if l.policy == FailPolicy {
+		return l, true, &StateLimitError{Limit: limit, Max: l.max, Actual: actual}
+	}
+
+	return l, true, nil
+}
+
+// limitEvents enforces the EventsLimit on the given events. Only FailPolicy is supported, see checkStateLimits.
+func (sf *stepFlowImpl) limitEvents(events []string) error {
+	_, _, err := sf.checkLimit(EventsLimit, len(events))
+	return err
+}
+
+// limitHistory enforces the HistoryLimit on the given history, if enabled.
+func (sf *stepFlowImpl) limitHistory(h *history) error {
+	if h == nil {
+		return nil
+	}
+
+	l, exceeded, err := sf.checkLimit(HistoryLimit, len(h.entries))
+	if err != nil || !exceeded {
+		return err
+	}
+
+	if l.policy == TruncateOldestPolicy {
+		h.entries = h.entries[len(h.entries)-l.max:]
+	} else {
+		h.entries = h.entries[:l.max]
+	}
+
+	return nil
+}
+
+// limitVariables enforces the VariablesBytesLimit on the saved variables of the state.
+// With DropPolicy, the variables are restored to the given old value, if any.
+func (sf *stepFlowImpl) limitVariables(state *State, oldVars json.RawMessage) error {
+	_, exceeded, err := sf.checkLimit(VariablesBytesLimit, len(state.Data[varsKey]))
+	if err != nil || !exceeded {
+		return err
+	}
+
+	if oldVars == nil {
+		delete(state.Data, varsKey)
+		return nil
+	}
+
+	state.Data[varsKey] = oldVars
+	return nil
+}
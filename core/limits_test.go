@@ -0,0 +1,144 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestStateLimit_Variables(t *testing.T) {
+	item := core.NewStepsItem("ingest", []core.StepFlowItem{
+		core.NewFuncItem("small", func(ctx context.Context) error {
+			return core.Vars(ctx).Set("batch", "small")
+		}),
+		core.NewFuncItem("large", func(ctx context.Context) error {
+			return core.Vars(ctx).Set("batch", strings.Repeat("x", 100))
+		}),
+	})
+
+	tests := []struct {
+		policy       core.LimitPolicy
+		expectedErr  bool
+		expectedVars string
+	}{
+		{core.FailPolicy, true, `{"batch":"` + strings.Repeat("x", 100) + `"}`},
+		{core.DropPolicy, false, `{"batch":"small"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			sf, err := core.NewStepFlow(item, core.WithStateLimit(core.VariablesBytesLimit, 50, tt.policy))
+			if err != nil {
+				t.Fatalf("Failed to create step flow: %v", err)
+			}
+
+			state, err := sf.ApplyState(context.Background(), core.State{})
+			if err != nil {
+				t.Fatalf("ApplyState returned an error: %v", err)
+			}
+
+			// The large step exceeds the limit
+			state, err = sf.ApplyState(context.Background(), state)
+
+			var limitErr *core.StateLimitError
+			if tt.expectedErr != errors.As(err, &limitErr) {
+				t.Fatalf("Unexpected error %v", err)
+			}
+
+			// The new state is returned in both cases, so the large step is not called again
+			if string(state.Data["vars"]) != tt.expectedVars || state.Events[0] != "completed:ingest/large" {
+				t.Fatalf("Expected variables %s, got %s and %v", tt.expectedVars, state.Data["vars"], state.Events)
+			}
+		})
+	}
+}
+
+func TestStateLimit_History(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	item := core.NewStepsItem("deploy", []core.StepFlowItem{
+		core.NewFuncItem("prepare", noop),
+		core.NewFuncItem("deploy", noop),
+	})
+
+	tests := []struct {
+		policy         core.LimitPolicy
+		expectedSource string
+	}{
+		{core.TruncateOldestPolicy, "start:deploy/deploy"},
+		{core.DropPolicy, "start:deploy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			sf, err := core.NewStepFlow(item, core.WithHistory(100), core.WithStateLimit(core.HistoryLimit, 2, tt.policy))
+			if err != nil {
+				t.Fatalf("Failed to create step flow: %v", err)
+			}
+
+			var state core.State
+			for range 3 {
+				state, err = sf.ApplyState(context.Background(), state)
+				if err != nil {
+					t.Fatalf("ApplyState returned an error: %v", err)
+				}
+			}
+
+			entries, err := core.HistoryFromState(state)
+			if err != nil {
+				t.Fatalf("HistoryFromState returned an error: %v", err)
+			}
+
+			if len(entries) != 2 || entries[0].Source != tt.expectedSource {
+				t.Fatalf("Unexpected history %+v", entries)
+			}
+		})
+	}
+}
+
+func TestStateLimit_Events(t *testing.T) {
+	var calls int
+	item := core.NewStepsItem("deploy", []core.StepFlowItem{
+		core.NewFuncItem("a", func(ctx context.Context) error { calls++; return nil }),
+	})
+
+	sf, err := core.NewStepFlow(item, core.WithStateLimit(core.EventsLimit, 1, core.FailPolicy))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	state, err := sf.ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	if calls != 1 || len(state.Events) != 1 {
+		t.Fatalf("Expected 1 call and 1 event, got %d calls and %v", calls, state.Events)
+	}
+}
+
+func TestStateLimit_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  core.StateLimit
+		max    int
+		policy core.LimitPolicy
+	}{
+		{name: "truncated variables", limit: core.VariablesBytesLimit, max: 10, policy: core.TruncateOldestPolicy},
+		{name: "truncated events", limit: core.EventsLimit, max: 1, policy: core.TruncateOldestPolicy},
+		{name: "dropped events", limit: core.EventsLimit, max: 1, policy: core.DropPolicy},
+		{name: "no events", limit: core.EventsLimit, max: 0, policy: core.FailPolicy},
+		{name: "history without WithHistory", limit: core.HistoryLimit, max: 10, policy: core.TruncateOldestPolicy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := core.NewStepFlow(core.NewStepsItem("deploy", nil), core.WithStateLimit(tt.limit, tt.max, tt.policy))
+			if err == nil {
+				t.Fatal("Expected an error for an unsupported limit")
+			}
+		})
+	}
+}
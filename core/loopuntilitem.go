@@ -54,6 +54,8 @@ func (lui *loopUntilItem) Transitions(parent Scope) (Scope, []Transition, error)
 			NewReason(StartCommand(itemScope), "LoopUntil condition is not met"),
 			NewReason(CompletedEvent(scope), "LoopUntil condition is met"),
 		}),
+		// When the item fails, re-raise the failure
+		reRaiseFailure(itemScope),
 	}
 
 	// Add item transitions.
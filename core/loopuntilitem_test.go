@@ -38,12 +38,13 @@ func TestNewLoopUntilItem(t *testing.T) {
 		t.Fatalf("Expected scope name 'test', got '%s'", scope.Name())
 	}
 
-	// For a loop with a child, we should have 3 transitions:
+	// For a loop with a child, we should have 4 transitions:
 	// 1. Start loop -> Start child
-	// 2. Start child -> Completed child (from child)
-	// 3. Completed child -> Start child or Completed loop (from condition)
-	if len(transitions) != 3 {
-		t.Fatalf("Expected 3 transitions, got %d", len(transitions))
+	// 2. Completed child -> Start child or Completed loop (from condition)
+	// 3. Failed child -> Failed loop
+	// 4. Start child -> Completed child (from child)
+	if len(transitions) != 4 {
+		t.Fatalf("Expected 4 transitions, got %d", len(transitions))
 	}
 
 	// Find the transition from completed child
@@ -193,7 +194,7 @@ func TestLoopUntilItem_ChildError(t *testing.T) {
 	_, err = sf.Apply(context.Background(), nil)
 
 	// Check the error
-	if err != expectedErr {
+	if !errors.Is(err, expectedErr) {
 		t.Fatalf("Expected error %v, got %v", expectedErr, err)
 	}
 }
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Migrator rewrites the states of one workflow definition, e.g. "deploy.v1", into states of another one, e.g. "deploy.v2".
+// Events are mapped by replacing the root scope name, after applying the scope and event mappings declared
+// for renamed, moved or removed steps. An event can be mapped only if it is known to the new definition.
+type Migrator struct {
+	from   *stepFlowImpl
+	to     *stepFlowImpl
+	scopes map[string]string
+	events map[string]string
+}
+
+// NewMigrator creates a new migrator of the states of the from workflow into states of the to workflow.
+// Both workflows must be created with NewStepFlow.
+func NewMigrator(from StepFlow, to StepFlow) (*Migrator, error) {
+	fromImpl, ok := from.(*stepFlowImpl)
+	if !ok {
+		return nil, fmt.Errorf("unsupported step flow %T", from)
+	}
+
+	toImpl, ok := to.(*stepFlowImpl)
+	if !ok {
+		return nil, fmt.Errorf("unsupported step flow %T", to)
+	}
+
+	return &Migrator{from: fromImpl, to: toImpl, scopes: make(map[string]string), events: make(map[string]string)}, nil
+}
+
+// MapScope maps the events of an old scope and of its child scopes to a new scope, e.g. for a renamed or moved step.
+// Scopes are relative to the root scope, as found in the state, e.g. "stepsRetry/validate".
+func (m *Migrator) MapScope(oldScope string, newScope string) *Migrator {
+	m.scopes[oldScope] = newScope
+	return m
+}
+
+// MapEvent maps an old event to a new event, e.g. "start:deploy.v1/validate" to "start:deploy.v2/deploy"
+// for a removed "validate" step. Event mappings take precedence over scope mappings.
+func (m *Migrator) MapEvent(oldEvent string, newEvent string) *Migrator {
+	m.events[oldEvent] = newEvent
+	return m
+}
+
+// Unmapped returns the events of the old definition that cannot be mapped to events of the new definition.
+// It compares the transitions of both definitions, so it can be checked before any state is migrated.
+func (m *Migrator) Unmapped() []string {
+	var unmapped []string
+	for _, event := range m.from.knownEvents() {
+		if _, ok := m.mapEvent(event); !ok {
+			unmapped = append(unmapped, event)
+		}
+	}
+
+	return unmapped
+}
+
+// Migrate rewrites the events of the given state into events of the new definition.
+// The versions chosen by versioned items are kept, unless their scope cannot be mapped,
+// and their recorded fingerprints are replaced with the fingerprints of the versions of the new definition.
+// The fingerprint of the state, if any, is replaced with the fingerprint of the new definition,
+// compact states are encoded with the dictionary of the new definition, encrypted data is encrypted again
+// with the cipher of the new definition and the new state is signed, if the new definition has a signing key.
+// It returns a *MigrationError if any of the events cannot be mapped.
+func (m *Migrator) Migrate(state State) (State, error) {
+	if err := checkStateVersion(state.Version); err != nil {
+		return State{}, err
+	}
+
+	if err := m.from.verifyState(state); err != nil {
+		return State{}, err
+	}
+
+	_, isCompact := state.Metadata[dictionaryKey]
+	state, err := m.from.ExpandState(state)
+	if err != nil {
+		return State{}, err
+	}
+
+	newState := state.Clone()
+	if err := m.from.decryptData(&newState); err != nil {
+		return State{}, err
+	}
+	newState.Events = nil
+
+	var unmapped []string
+	for _, event := range state.Events {
+		newEvent, ok := m.mapEvent(event)
+		if !ok {
+			unmapped = append(unmapped, event)
+			continue
+		}
+
+		newState.Events = append(newState.Events, newEvent)
+	}
+
+	if len(unmapped) > 0 {
+		return State{}, &MigrationError{Events: unmapped}
+	}
+
+	if _, found := newState.Metadata[fingerprintKey]; found {
+		newState.Metadata[fingerprintKey] = m.to.fingerprint
+	}
+
+	if scope, found := newState.Metadata[failedScopeKey]; found {
+		if newScope, ok := m.mapScope(scope); ok {
+			newState.Metadata[failedScopeKey] = newScope
+		}
+	}
+
+	if err := m.migrateData(&newState); err != nil {
+		return State{}, err
+	}
+
+	m.to.nextRevision(&newState)
+
+	if err := m.to.encryptData(&newState); err != nil {
+		return State{}, err
+	}
+
+	if isCompact {
+		if newState, err = m.to.CompactState(newState); err != nil {
+			return State{}, err
+		}
+	}
+
+	if err := m.to.signState(&newState); err != nil {
+		return State{}, err
+	}
+
+	return newState, nil
+}
+
+// migrateData rewrites the decrypted state data keyed by scopes or events of the old definition, i.e. the versions
+// chosen by versioned items and the attempts of failing steps. Entries that cannot be mapped are removed.
+func (m *Migrator) migrateData(state *State) error {
+	for dataKey, mapKey := range map[string]func(string) (string, bool){versionsKey: m.mapVersionedScope, attemptsKey: m.mapEvent} {
+		data, found := state.Data[dataKey]
+		if !found {
+			continue
+		}
+
+		var values, newValues map[string]json.RawMessage
+		if err := json.Unmarshal(data, &values); err != nil {
+			return err
+		}
+
+		for key, value := range values {
+			if newKey, ok := mapKey(key); ok {
+				if dataKey == versionsKey {
+					var err error
+					if value, err = m.migrateVersion(newKey, value); err != nil {
+						return err
+					}
+				}
+
+				if newValues == nil {
+					newValues = make(map[string]json.RawMessage)
+				}
+				newValues[newKey] = value
+			}
+		}
+
+		if len(newValues) == 0 {
+			delete(state.Data, dataKey)
+			continue
+		}
+
+		newData, err := json.Marshal(newValues)
+		if err != nil {
+			return err
+		}
+
+		state.Data[dataKey] = newData
+	}
+
+	return nil
+}
+
+// mapEvent maps an old event to a new event, and checks if the new event is known to the new definition.
+func (m *Migrator) mapEvent(event string) (string, bool) {
+	if newEvent, found := m.events[event]; found {
+		return newEvent, m.to.isKnownEvent(newEvent)
+	}
+
+	name, scope, found := strings.Cut(event, eventSeparator)
+	if !found {
+		return "", false
+	}
+
+	newScope, ok := m.mapScope(scope)
+	if !ok {
+		return "", false
+	}
+
+	newEvent := name + eventSeparator + newScope
+	return newEvent, m.to.isKnownEvent(newEvent)
+}
+
+// mapVersionedScope maps the scope of a versioned item, and checks if the new scope is known to the new definition.
+func (m *Migrator) mapVersionedScope(scope string) (string, bool) {
+	newScope, ok := m.mapScope(scope)
+	return newScope, ok && m.to.isKnownEvent(eventString(StartCommand(&scopeImpl{name: newScope})))
+}
+
+// mapScope maps a fully qualified scope of the old definition to a scope of the new definition,
+// using the longest matching scope mapping.
+func (m *Migrator) mapScope(scope string) (string, bool) {
+	fromRoot, toRoot := m.from.scope.Name(), m.to.scope.Name()
+	if scope == fromRoot {
+		return toRoot, true
+	}
+
+	relative, found := strings.CutPrefix(scope, fromRoot+scopeSeparator)
+	if !found {
+		return "", false
+	}
+
+	var matched string
+	for oldScope := range m.scopes {
+		if isSameOrParentScope(oldScope, relative) && len(oldScope) > len(matched) {
+			matched = oldScope
+		}
+	}
+
+	if matched != "" {
+		relative = m.scopes[matched] + relative[len(matched):]
+	}
+
+	return toRoot + scopeSeparator + relative, true
+}
+
+// knownEvents returns the sorted events known to the workflow definition, see isKnownEvent.
+func (sf *stepFlowImpl) knownEvents() []string {
+	var events []string
+	for event := range sf.transitionsMap {
+		events = append(events, event)
+	}
+
+	events = append(events, sf.completedState...)
+	events = append(events, sf.timedOutState...)
+	events = append(events, sf.failedState...)
+	slices.Sort(events)
+	return slices.Compact(events)
+}
+
+// MigrationError is returned by Migrator.Migrate when some events of the state cannot be mapped.
+type MigrationError struct {
+	// Events are the events of the state that cannot be mapped.
+	Events []string
+}
+
+// Error implements the error interface.
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("cannot migrate events %s", e.Events)
+}
+
+// migrateVersion replaces the fingerprint of the given recorded version with the fingerprint of the same version
+// of the versioned item of the given scope in the new definition.
+func (m *Migrator) migrateVersion(scope string, value json.RawMessage) (json.RawMessage, error) {
+	var recorded recordedVersion
+	if err := json.Unmarshal(value, &recorded); err != nil {
+		return nil, err
+	}
+
+	recorded.Fingerprint = m.to.versions[scope][recorded.Version]
+	return json.Marshal(recorded)
+}
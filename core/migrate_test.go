@@ -0,0 +1,160 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestMigrator(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+
+	// In v2, the validate step is renamed to verify and moved into the checks steps, and the notify step is removed
+	v1, err := core.NewStepFlow(core.NewStepsItem("deploy.v1", []core.StepFlowItem{
+		core.NewFuncItem("prepare", noop),
+		core.NewFuncItem("validate", noop),
+		core.NewFuncItem("notify", noop),
+		core.NewFuncItem("deploy", noop),
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	v2, err := core.NewStepFlow(core.NewStepsItem("deploy.v2", []core.StepFlowItem{
+		core.NewFuncItem("prepare", noop),
+		core.NewStepsItem("checks", []core.StepFlowItem{core.NewFuncItem("verify", noop)}),
+		core.NewFuncItem("deploy", noop),
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	migrator, err := core.NewMigrator(v1, v2)
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+
+	// Without mappings, the events of the renamed and removed steps cannot be mapped
+	expectedUnmapped := []string{"completed:deploy.v1/notify", "completed:deploy.v1/validate", "failed:deploy.v1/notify",
+		"failed:deploy.v1/validate", "start:deploy.v1/notify", "start:deploy.v1/validate"}
+	if unmapped := migrator.Unmapped(); !reflect.DeepEqual(unmapped, expectedUnmapped) {
+		t.Fatalf("Expected unmapped events %v, got %v", expectedUnmapped, unmapped)
+	}
+
+	_, err = migrator.Migrate(core.StateFromStrings([]string{"start:deploy.v1/validate"}))
+	var migrationErr *core.MigrationError
+	if !errors.As(err, &migrationErr) || !reflect.DeepEqual(migrationErr.Events, []string{"start:deploy.v1/validate"}) {
+		t.Fatalf("Expected a *MigrationError, got %v", err)
+	}
+
+	// Declare the mappings
+	migrator.MapScope("validate", "checks/verify").
+		MapEvent("start:deploy.v1/notify", "start:deploy.v2/deploy").
+		MapEvent("completed:deploy.v1/notify", "start:deploy.v2/deploy").
+		MapEvent("failed:deploy.v1/notify", "failed:deploy.v2/deploy")
+
+	if unmapped := migrator.Unmapped(); unmapped != nil {
+		t.Fatalf("Expected no unmapped events, got %v", unmapped)
+	}
+
+	tests := []struct {
+		old      string
+		expected string
+	}{
+		{"start:deploy.v1/prepare", "start:deploy.v2/prepare"},
+		{"start:deploy.v1/validate", "start:deploy.v2/checks/verify"},
+		{"completed:deploy.v1/notify", "start:deploy.v2/deploy"},
+		{"completed:deploy.v1", "completed:deploy.v2"},
+	}
+
+	for _, tt := range tests {
+		state := core.StateFromStrings([]string{tt.old})
+		state.SetMetadata("startedAt", "2026-01-01T00:00:00Z")
+
+		migrated, err := migrator.Migrate(state)
+		if err != nil {
+			t.Fatalf("Migrate returned an error: %v", err)
+		}
+
+		if !reflect.DeepEqual(migrated.Events, []string{tt.expected}) {
+			t.Fatalf("Expected events [%s], got %v", tt.expected, migrated.Events)
+		}
+
+		// Metadata is kept
+		if migrated.Metadata["startedAt"] != "2026-01-01T00:00:00Z" {
+			t.Fatalf("Expected metadata to be kept, got %v", migrated.Metadata)
+		}
+
+		// The migrated state can be applied by the new definition
+		if diagnostics := v2.ValidateState(migrated); diagnostics != nil {
+			t.Fatalf("Expected no diagnostics, got %v", diagnostics)
+		}
+	}
+}
+
+func TestMigrator_Versions(t *testing.T) {
+	var calls []string
+	cipher, err := core.NewAESGCMCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+
+	newFlow := func(name string, versions ...int) core.StepFlow {
+		items := make(map[int]core.StepFlowItem)
+		for _, version := range versions {
+			versionName := fmt.Sprintf("v%d", version)
+			items[version] = core.NewFuncItem(versionName, func(ctx context.Context) error {
+				calls = append(calls, versionName)
+				return nil
+			})
+		}
+
+		sf, err := core.NewStepFlow(core.NewStepsItem(name, []core.StepFlowItem{
+			core.NewFuncItem("prepare", func(ctx context.Context) error { return nil }),
+			core.NewVersionedItem("rolloutVersioned", items),
+		}), core.WithCipher(cipher))
+		if err != nil {
+			t.Fatalf("Failed to create step flow: %v", err)
+		}
+
+		return sf
+	}
+
+	v1, v2 := newFlow("deploy.v1", 1), newFlow("deploy.v2", 1, 2)
+
+	// The running instance records version 1 in its encrypted data
+	state, err := v1.ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	if state, err = v1.ApplyState(context.Background(), state); err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	migrator, err := core.NewMigrator(v1, v2)
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+
+	migrated, err := migrator.Migrate(state)
+	if err != nil {
+		t.Fatalf("Migrate returned an error: %v", err)
+	}
+
+	// The recorded version is rewritten for the new root scope, so the migrated instance keeps version 1
+	calls = nil
+	for range 2 {
+		if migrated, err = v2.ApplyState(context.Background(), migrated); err != nil {
+			t.Fatalf("ApplyState returned an error: %v", err)
+		}
+	}
+
+	if !v2.IsCompleted(migrated.Strings()) || !reflect.DeepEqual(calls, []string{"v1"}) {
+		t.Fatalf("Expected the migrated instance to complete version 1, got %v and calls %v", migrated.Events, calls)
+	}
+}
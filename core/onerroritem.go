@@ -0,0 +1,165 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// RecoveryBranch is a recovery sub-flow of an OnError item.
+type RecoveryBranch struct {
+	// Item is executed when the classifier selects the branch.
+	Item StepFlowItem
+
+	// ContinueAfter makes the OnError item complete once the branch completes,
+	// instead of resuming the body from its start.
+	ContinueAfter bool
+}
+
+// errorRoutingTransition wraps a transition of the body of an OnError item.
+// It routes errors to the recovery branch selected by the classifier function.
+type errorRoutingTransition struct {
+	transition     Transition
+	classifierFunc func(err error) string
+	branchStarts   map[string]Event
+	scope          Scope
+	bodyScope      Scope
+}
+
+// Source returns the source event of the wrapped transition.
+func (et *errorRoutingTransition) Source() Event {
+	return et.transition.Source()
+}
+
+// Destination evaluates the wrapped transition and routes any error, or failure of the body, to the matching
+// recovery branch. Errors and failures that do not match any branch are propagated.
+func (et *errorRoutingTransition) Destination(ctx context.Context) ([]Event, error) {
+	events, err := et.transition.Destination(ctx)
+	if err != nil {
+		return et.route(ctx, err, events, err)
+	}
+
+	if containsEvent(events, FailedEvent(et.bodyScope)) {
+		return et.route(ctx, currentFailure(ctx, et.bodyScope), events, nil)
+	}
+
+	return events, nil
+}
+
+// route returns the start of the recovery branch selected for cause, or the given events and error otherwise.
+func (et *errorRoutingTransition) route(ctx context.Context, cause error, events []Event, err error) ([]Event, error) {
+	branchName, classifierErr := callWithRecover(ctx, et.scope, func() (string, error) {
+		return et.classifierFunc(cause), nil
+	})
+	if classifierErr != nil {
+		return nil, classifierErr
+	}
+
+	if branchStart, found := et.branchStarts[branchName]; found {
+		recordHandledFailure(ctx, cause)
+		clearFailure(ctx)
+		return []Event{branchStart}, nil
+	}
+
+	return events, err
+}
+
+// IsExclusive delegates to the wrapped transition.
+func (et *errorRoutingTransition) IsExclusive() bool {
+	return et.transition.IsExclusive()
+}
+
+// PossibleDestinations returns all possible destinations, including the start of each recovery branch.
+func (et *errorRoutingTransition) PossibleDestinations() []PossibleDestination {
+	var result []PossibleDestination
+	result = append(result, et.transition.PossibleDestinations()...)
+	for _, branchName := range slices.Sorted(maps.Keys(et.branchStarts)) {
+		result = append(result, NewReason(et.branchStarts[branchName], "OnError "+branchName))
+	}
+	return result
+}
+
+// onErrorItem represents a workflow item that executes a body item and routes its errors to recovery branches.
+// Once a recovery branch completes, the body is either resumed from its start or skipped.
+type onErrorItem struct {
+	scope          Scope
+	body           StepFlowItem
+	classifierFunc func(err error) string
+	branches       map[string]RecoveryBranch
+}
+
+// NewOnErrorItem creates a new workflow item that executes the body item and, when it fails,
+// executes the recovery branch named by the classifier function.
+// Errors for which the classifier returns a name without a matching branch are propagated.
+func NewOnErrorItem(name string, body StepFlowItem, classifierFunc func(err error) string, branches map[string]RecoveryBranch) StepFlowItem {
+	return &onErrorItem{scope: NewScope(name), body: body, classifierFunc: classifierFunc, branches: branches}
+}
+
+// Transitions implements the StepFlowItem interface.
+// It connects the start of the item to the body, each recovery branch back to the body or to the item completion,
+// and wraps the body transitions to route their errors to the recovery branches.
+func (oi *onErrorItem) Transitions(parent Scope) (Scope, []Transition, error) {
+	scope := WithParent(oi.scope, parent)
+
+	// Get the body's scope and transitions.
+	bodyScope, bodyTransitions, err := oi.body.Transitions(scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transitions := []Transition{
+		// When the item starts, start the body.
+		NewStaticTransition(StartCommand(scope), StartCommand(bodyScope)),
+		// When the body completes, complete the item.
+		NewStaticTransition(CompletedEvent(bodyScope), CompletedEvent(scope)),
+		// When the body failure is not routed to a branch, re-raise it.
+		reRaiseFailure(bodyScope),
+	}
+
+	// Track seen names to ensure uniqueness within this scope.
+	seenNames := map[string]bool{bodyScope.Name(): true}
+	branchStarts := make(map[string]Event)
+
+	for _, branchName := range slices.Sorted(maps.Keys(oi.branches)) {
+		branch := oi.branches[branchName]
+
+		// Get the branch's scope and transitions.
+		branchScope, branchTransitions, err := branch.Item.Transitions(scope)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Ensure uniqueness of branch names.
+		if seenNames[branchScope.Name()] {
+			return nil, nil, fmt.Errorf("name %s must be unique in the current context", branchScope.Name())
+		}
+		seenNames[branchScope.Name()] = true
+
+		branchStarts[branchName] = StartCommand(branchScope)
+
+		// When the branch completes, either skip or resume the body.
+		if branch.ContinueAfter {
+			transitions = append(transitions, NewStaticTransition(CompletedEvent(branchScope), CompletedEvent(scope)))
+		} else {
+			transitions = append(transitions, NewStaticTransition(CompletedEvent(branchScope), StartCommand(bodyScope)))
+		}
+
+		// Add all branch transitions and re-raise the branch failures.
+		transitions = append(transitions, branchTransitions...)
+		transitions = append(transitions, reRaiseFailure(branchScope))
+	}
+
+	// Wrap each body transition with error routing.
+	for _, transition := range bodyTransitions {
+		transitions = append(transitions, &errorRoutingTransition{
+			transition:     transition,
+			classifierFunc: oi.classifierFunc,
+			branchStarts:   branchStarts,
+			scope:          scope,
+			bodyScope:      bodyScope,
+		})
+	}
+
+	return scope, transitions, nil
+}
@@ -0,0 +1,193 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+var errQuota = errors.New("quota exceeded")
+
+func classifyQuota(err error) string {
+	if errors.Is(err, errQuota) {
+		return "quota"
+	}
+	return ""
+}
+
+func TestNewOnErrorItem(t *testing.T) {
+	// Create an on error item with a single recovery branch
+	body := core.NewFuncItem("body", func(ctx context.Context) error { return nil })
+	branch := core.NewFuncItem("quota", func(ctx context.Context) error { return nil })
+
+	item := core.NewOnErrorItem("test", body, classifyQuota, map[string]core.RecoveryBranch{
+		"quota": {Item: branch},
+	})
+
+	// Get transitions
+	scope, transitions, err := item.Transitions(nil)
+	if err != nil {
+		t.Fatalf("Transitions returned an error: %v", err)
+	}
+
+	if scope.Name() != "test" {
+		t.Fatalf("Expected scope name 'test', got '%s'", scope.Name())
+	}
+
+	// Check transitions: start, completion, body failure, branch completion, branch function,
+	// branch failure and body function
+	if len(transitions) != 7 {
+		t.Fatalf("Expected 7 transitions, got %d", len(transitions))
+	}
+
+	// The branch is a real scope and its start is a possible destination of the body
+	foundBranchStart := false
+	for _, transition := range transitions {
+		if transition.Source().Scope().Name() != "test/body" {
+			continue
+		}
+
+		for _, pd := range transition.PossibleDestinations() {
+			if pd.Event().Name() == "start" && pd.Event().Scope().Name() == "test/quota" {
+				foundBranchStart = true
+			}
+		}
+	}
+
+	if !foundBranchStart {
+		t.Fatal("Expected branch start in possible destinations")
+	}
+}
+
+func TestNewOnErrorItem_DuplicateName(t *testing.T) {
+	// Create an on error item with a branch named like the body
+	body := core.NewFuncItem("body", func(ctx context.Context) error { return nil })
+	branch := core.NewFuncItem("body", func(ctx context.Context) error { return nil })
+
+	item := core.NewOnErrorItem("test", body, classifyQuota, map[string]core.RecoveryBranch{
+		"body": {Item: branch},
+	})
+
+	// Get transitions
+	_, _, err := item.Transitions(nil)
+	if err == nil {
+		t.Fatal("Expected an error for duplicate names")
+	}
+}
+
+func TestOnErrorItem_Resume(t *testing.T) {
+	// Track execution order
+	executionOrder := []string{}
+
+	body := core.NewFuncItem("body", func(ctx context.Context) error {
+		executionOrder = append(executionOrder, "body")
+		if len(executionOrder) == 1 {
+			return errQuota
+		}
+		return nil
+	})
+
+	branch := core.NewFuncItem("quota", func(ctx context.Context) error {
+		executionOrder = append(executionOrder, "quota")
+		return nil
+	})
+
+	item := core.NewOnErrorItem("test", body, classifyQuota, map[string]core.RecoveryBranch{
+		"quota": {Item: branch},
+	})
+
+	sf, err := core.NewStepFlow(item)
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Apply the step flow
+	var state []string
+	for range 4 {
+		state, err = sf.Apply(context.Background(), state)
+		if err != nil {
+			t.Fatalf("Apply returned an error: %v", err)
+		}
+	}
+
+	// stepflow should have been completed after the expected number of iterations.
+	if !sf.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	expectedOrder := "[body quota body]"
+	if fmt.Sprintf("%s", executionOrder) != expectedOrder {
+		t.Fatalf("Expected execution order %s, got %s", expectedOrder, executionOrder)
+	}
+}
+
+func TestOnErrorItem_ContinueAfter(t *testing.T) {
+	// Track execution order
+	executionOrder := []string{}
+
+	body := core.NewFuncItem("body", func(ctx context.Context) error {
+		executionOrder = append(executionOrder, "body")
+		return errQuota
+	})
+
+	branch := core.NewFuncItem("quota", func(ctx context.Context) error {
+		executionOrder = append(executionOrder, "quota")
+		return nil
+	})
+
+	item := core.NewOnErrorItem("test", body, classifyQuota, map[string]core.RecoveryBranch{
+		"quota": {Item: branch, ContinueAfter: true},
+	})
+
+	sf, err := core.NewStepFlow(item)
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Apply the step flow
+	var state []string
+	for range 3 {
+		state, err = sf.Apply(context.Background(), state)
+		if err != nil {
+			t.Fatalf("Apply returned an error: %v", err)
+		}
+	}
+
+	// stepflow should have been completed after the expected number of iterations.
+	if !sf.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	expectedOrder := "[body quota]"
+	if fmt.Sprintf("%s", executionOrder) != expectedOrder {
+		t.Fatalf("Expected execution order %s, got %s", expectedOrder, executionOrder)
+	}
+}
+
+func TestOnErrorItem_Unclassified(t *testing.T) {
+	// Create an on error item with a body failing with an unclassified error
+	expectedErr := errors.New("test error")
+	body := core.NewFuncItem("body", func(ctx context.Context) error {
+		return expectedErr
+	})
+
+	item := core.NewOnErrorItem("test", body, classifyQuota, map[string]core.RecoveryBranch{
+		"quota": {Item: core.NewFuncItem("quota", func(ctx context.Context) error { return nil })},
+	})
+
+	sf, err := core.NewStepFlow(item)
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Apply the step flow
+	_, err = sf.Apply(context.Background(), nil)
+
+	// Check that the error was propagated
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("Expected error %v, got %v", expectedErr, err)
+	}
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// Option configures a StepFlow created with NewStepFlow.
+type Option func(*options)
+
+// options holds the StepFlow configuration.
+type options struct {
+	recoverPanics     bool
+	failureEvents     bool
+	deadline          time.Duration
+	deadlineHandler   StepFlowItem
+	now               func() time.Time
+	fingerprint       bool
+	compactState      bool
+	historyMaxEntries int
+	signingKey        []byte
+	cipher            Cipher
+	revision          bool
+	attempts          bool
+	limits            map[StateLimit]stateLimit
+}
+
+// defaultOptions returns the default StepFlow configuration.
+func defaultOptions() options {
+	return options{recoverPanics: true, now: time.Now}
+}
+
+// newOptions returns the StepFlow configuration obtained by applying the given options on top of the defaults.
+func newOptions(opts []Option) options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithPanicRecovery enables or disables the recovery of panics raised by activities, conditions and error handlers.
+// When enabled, which is the default, a panic is returned as a *StepPanicError and is subject to the normal Retry handling.
+// When disabled, a panic unwinds through StepFlow.Apply.
+func WithPanicRecovery(enabled bool) Option {
+	return func(o *options) {
+		o.recoverPanics = enabled
+	}
+}
+
+// WithFailureEvents enables or disables failure events. When enabled, a failing step emits a FailedEvent
+// instead of returning an error. The failure is re-raised up the scope hierarchy until an item handles it,
+// like Retry, or until it reaches the root item. The failed root is a terminal state recorded in the state,
+// for which Apply returns a *FailureError. Failure events are disabled by default.
+func WithFailureEvents(enabled bool) Option {
+	return func(o *options) {
+		o.failureEvents = enabled
+	}
+}
+
+// WithDeadline sets an overall deadline for each workflow instance, measured from the first Apply call
+// that leaves the start state. The start time is stored in the state.
+// Once the deadline has passed, the instance is routed to the handler item, if not nil, and then moved to
+// the terminal timed-out state, for which Apply returns ErrDeadlineExceeded.
+func WithDeadline(deadline time.Duration, handler StepFlowItem) Option {
+	return func(o *options) {
+		o.deadline = deadline
+		o.deadlineHandler = handler
+	}
+}
+
+// WithClock sets the function used to get the current time. It defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithFingerprint enables or disables writing the fingerprint of the workflow definition into the state metadata.
+// Apply refuses states holding the fingerprint of another definition with ErrFingerprintMismatch,
+// whether the option is enabled or not. It is disabled by default.
+func WithFingerprint(enabled bool) Option {
+	return func(o *options) {
+		o.fingerprint = enabled
+	}
+}
+
+// WithCompactState enables or disables the compact encoding of the states returned by Apply, see StepFlow.CompactState.
+// Apply accepts both compact and readable states, whether the option is enabled or not. It is disabled by default.
+func WithCompactState(enabled bool) Option {
+	return func(o *options) {
+		o.compactState = enabled
+	}
+}
+
+// WithHistory enables an append-only history of the transitions applied to each workflow instance,
+// recorded in the state and read with StepFlow.History or HistoryFromState. Only the last maxEntries entries are kept.
+// The history is disabled by default, or when maxEntries is not positive.
+func WithHistory(maxEntries int) Option {
+	return func(o *options) {
+		o.historyMaxEntries = maxEntries
+	}
+}
+
+// WithStateSigner signs the states returned by Apply with an HMAC-SHA256 of the given key, stored in the state metadata.
+// The signature covers the definition fingerprint, so a state cannot be used with another workflow definition.
+// Apply refuses states whose signature does not verify with ErrInvalidSignature, except empty states.
+func WithStateSigner(key []byte) Option {
+	return func(o *options) {
+		o.signingKey = key
+	}
+}
+
+// WithCipher encrypts the data section of the states returned by Apply, like variables and outputs, with the given cipher.
+// Events and metadata stay readable, except the failure message, which is moved to the encrypted data.
+// The encrypted data is bound to the events of the state, so it cannot be moved to another state.
+// States encrypted with an old key of the cipher are encrypted again with the current key.
+func WithCipher(c Cipher) Option {
+	return func(o *options) {
+		o.cipher = c
+	}
+}
+
+// WithRevision enables a revision number in the state, incremented by every Apply call, see State.Revision.
+// Stores use it with CheckRevision to detect two workers applying the same instance. States that already have
+// a revision keep incrementing it, whether the option is enabled or not. It is disabled by default.
+func WithRevision(enabled bool) Option {
+	return func(o *options) {
+		o.revision = enabled
+	}
+}
+
+// WithAttempts enables or disables storing the number of consecutive failures of each failing step in the state,
+// so that StepError.Attempt keeps counting across Apply calls. When disabled, which is the default,
+// failures are only counted within a single Apply call.
+func WithAttempts(enabled bool) Option {
+	return func(o *options) {
+		o.attempts = enabled
+	}
+}
+
+// WithStateLimit sets a limit on the state returned by Apply, enforced with the given policy:
+// FailPolicy makes Apply return a *StateLimitError, TruncateOldestPolicy removes the oldest entries
+// and DropPolicy drops the newest ones. Limits are not set by default.
+// With FailPolicy the step functions have already been called when the error is returned, so Apply also returns
+// the new state: storing it keeps them from being called again, while the caller decides how to handle the instance.
+func WithStateLimit(limit StateLimit, max int, policy LimitPolicy) Option {
+	return func(o *options) {
+		if o.limits == nil {
+			o.limits = make(map[StateLimit]stateLimit)
+		}
+		o.limits[limit] = stateLimit{max: max, policy: policy}
+	}
+}
+
+// optionsContextKey is the context key used to make the StepFlow configuration available to transitions.
+type optionsContextKey struct{}
+
+// withOptions returns a copy of ctx that carries the given StepFlow configuration.
+func withOptions(ctx context.Context, o options) context.Context {
+	return context.WithValue(ctx, optionsContextKey{}, o)
+}
+
+// optionsFromContext returns the StepFlow configuration carried by ctx, or the default configuration if none.
+func optionsFromContext(ctx context.Context) options {
+	if o, ok := ctx.Value(optionsContextKey{}).(options); ok {
+		return o
+	}
+
+	return defaultOptions()
+}
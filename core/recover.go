@@ -0,0 +1,49 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// StepPanicError is returned when an activity, condition or error handler panics
+// and panic recovery is enabled.
+type StepPanicError struct {
+	// Scope is the fully qualified name of the scope in which the panic occurred.
+	Scope string
+
+	// Value is the value passed to panic.
+	Value any
+
+	// Stack is the stack trace captured when the panic was recovered.
+	Stack []byte
+}
+
+// Error implements the error interface.
+func (e *StepPanicError) Error() string {
+	return fmt.Sprintf("step %s panicked: %v", e.Scope, e.Value)
+}
+
+// Unwrap returns the panic value if it is an error, or nil otherwise.
+func (e *StepPanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// callWithRecover calls fn and, when panic recovery is enabled in ctx, converts a panic into a *StepPanicError.
+func callWithRecover[T any](ctx context.Context, scope Scope, fn func() (T, error)) (result T, err error) {
+	if !optionsFromContext(ctx).recoverPanics {
+		return fn()
+	}
+
+	defer func() {
+		if value := recover(); value != nil {
+			err = &StepPanicError{Scope: scope.Name(), Value: value, Stack: debug.Stack()}
+		}
+	}()
+
+	return fn()
+}
@@ -0,0 +1,130 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestStepFlow_Apply_PanicRecovered(t *testing.T) {
+	// Create a step flow with a function that panics
+	item := core.NewStepsItem("steps", []core.StepFlowItem{
+		core.NewFuncItem("panics", func(ctx context.Context) error {
+			panic("test panic")
+		}),
+	})
+
+	sf, err := core.NewStepFlow(item)
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Apply the step flow
+	_, err = sf.Apply(context.Background(), nil)
+
+	// Check that the panic was returned as an error
+	var panicErr *core.StepPanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("Expected *core.StepPanicError, got %v", err)
+	}
+
+	if panicErr.Scope != "steps/panics" {
+		t.Fatalf("Expected scope 'steps/panics', got '%s'", panicErr.Scope)
+	}
+
+	if panicErr.Value != "test panic" {
+		t.Fatalf("Expected value 'test panic', got '%v'", panicErr.Value)
+	}
+
+	if len(panicErr.Stack) == 0 {
+		t.Fatal("Expected a stack trace")
+	}
+}
+
+func TestStepFlow_Apply_PanicRetried(t *testing.T) {
+	// Track calls
+	callCount := 0
+
+	// Create a child item that panics on the first attempt
+	child := core.NewFuncItem("child", func(ctx context.Context) error {
+		callCount++
+		if callCount == 1 {
+			panic("first attempt panic")
+		}
+		return nil
+	})
+
+	// Create a retry item that only retries panics
+	item := core.NewRetryItem(child, func(ctx context.Context, err error) (bool, error) {
+		var panicErr *core.StepPanicError
+		return errors.As(err, &panicErr), nil
+	})
+
+	sf, err := core.NewStepFlow(item)
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Apply the step flow
+	var state []string
+	for range 2 {
+		state, err = sf.Apply(context.Background(), state)
+		if err != nil {
+			t.Fatalf("Apply returned an error: %v", err)
+		}
+	}
+
+	// stepflow should have been completed after the expected number of iterations.
+	if !sf.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+}
+
+func TestStepFlow_Apply_ErrorHandlerPanicRecovered(t *testing.T) {
+	// Create a retry item with an error handler that panics
+	child := core.NewFuncItem("child", func(ctx context.Context) error {
+		return errors.New("test error")
+	})
+
+	item := core.NewRetryItem(child, func(ctx context.Context, err error) (bool, error) {
+		panic("handler panic")
+	})
+
+	sf, err := core.NewStepFlow(item)
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Apply the step flow
+	_, err = sf.Apply(context.Background(), nil)
+
+	// Check that the handler panic was returned as an error
+	var panicErr *core.StepPanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("Expected *core.StepPanicError, got %v", err)
+	}
+}
+
+func TestStepFlow_Apply_PanicRecoveryDisabled(t *testing.T) {
+	// Create a step flow with a function that panics and panic recovery disabled
+	item := core.NewFuncItem("panics", func(ctx context.Context) error {
+		panic("test panic")
+	})
+
+	sf, err := core.NewStepFlow(item, core.WithPanicRecovery(false))
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Check that the panic unwinds through Apply
+	defer func() {
+		if value := recover(); value != "test panic" {
+			t.Fatalf("Expected panic 'test panic', got %v", value)
+		}
+	}()
+
+	_, _ = sf.Apply(context.Background(), nil)
+	t.Fatal("Expected Apply to panic")
+}
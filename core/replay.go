@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+)
+
+// DivergenceError is returned by Replay at the first history entry for which the workflow definition takes a different path.
+type DivergenceError struct {
+	// Index is the index of the history entry.
+	Index int
+
+	// Entry is the history entry.
+	Entry HistoryEntry
+
+	// Destinations are the destination events the workflow definition takes instead. It is empty if the definition
+	// does not handle the source event or the recorded reason.
+	Destinations []string
+}
+
+// Error implements the error interface.
+func (e *DivergenceError) Error() string {
+	return fmt.Sprintf("history entry %d diverges at %s: recorded %s, replayed %s", e.Index, e.Entry.Source, e.Entry.Destinations, e.Destinations)
+}
+
+// Replay checks that the workflow definition takes the same path as the recorded history, see WithHistory.
+// Step functions are not called: the outcomes of transitions, like condition results and activity failures,
+// are taken from the recorded reasons. It returns a *DivergenceError for the first entry for which
+// the definition takes a different path, or nil if the whole history can be replayed.
+func Replay(sf StepFlow, history []HistoryEntry) error {
+	impl, ok := sf.(*stepFlowImpl)
+	if !ok {
+		return fmt.Errorf("unsupported step flow %T", sf)
+	}
+
+	for i, entry := range history {
+		var destinations []string
+		if transitions, found := impl.transitionsMap[entry.Source]; found {
+			destinations = replayDestinations(transitions[0], entry)
+		}
+
+		if !slices.Equal(destinations, entry.Destinations) {
+			return &DivergenceError{Index: i, Entry: entry, Destinations: destinations}
+		}
+	}
+
+	return nil
+}
+
+// replayDestinations returns the destination events the transition takes for the recorded history entry:
+// the possible destinations with the recorded reason, or the failed event of the source scope for recorded failures.
+func replayDestinations(t Transition, entry HistoryEntry) []string {
+	if entry.Reason == "" && entry.Error != "" {
+		return []string{eventString(FailedEvent(t.Source().Scope()))}
+	}
+
+	var destinations []string
+	for _, possibleDestination := range t.PossibleDestinations() {
+		if possibleDestination.Reason() == entry.Reason {
+			destinations = append(destinations, eventString(possibleDestination.Event()))
+		}
+	}
+
+	return destinations
+}
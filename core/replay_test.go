@@ -0,0 +1,77 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestReplay(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	iterations := 0
+	newItems := func(extra ...core.StepFlowItem) []core.StepFlowItem {
+		items := []core.StepFlowItem{
+			core.NewCaseItem("canaryCase", core.NewFuncItem("canary", noop), func(ctx context.Context) (bool, error) {
+				return true, nil
+			}),
+			core.NewLoopUntilItem("waitLoopUntil", core.NewStepsItem("steps", []core.StepFlowItem{core.NewFuncItem("check", noop)}),
+				func(ctx context.Context) (bool, error) {
+					iterations++
+					return iterations == 2, nil
+				}),
+		}
+
+		return append(items, extra...)
+	}
+
+	sf, err := core.NewStepFlow(core.NewStepsItem("deploy", newItems(core.NewFuncItem("deploy", noop))), core.WithHistory(100))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	// Record the history of a completed instance
+	var state core.State
+	for range 10 {
+		state, err = sf.ApplyState(context.Background(), state)
+		if err != nil {
+			t.Fatalf("ApplyState returned an error: %v", err)
+		}
+	}
+
+	if !sf.IsCompleted(state.Strings()) {
+		t.Fatalf("Expected completed state, got %v", state.Events)
+	}
+
+	history, err := core.HistoryFromState(state)
+	if err != nil {
+		t.Fatalf("HistoryFromState returned an error: %v", err)
+	}
+
+	// The same definition replays the whole history, without calling the step functions
+	iterations = 0
+	if err := core.Replay(sf, history); err != nil {
+		t.Fatalf("Replay returned an error: %v", err)
+	}
+
+	if iterations != 0 {
+		t.Fatalf("Expected no condition calls, got %d", iterations)
+	}
+
+	// A definition with a step inserted before deploy takes a different path
+	changed, err := core.NewStepFlow(core.NewStepsItem("deploy", newItems(core.NewFuncItem("validate", noop), core.NewFuncItem("deploy", noop))))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	err = core.Replay(changed, history)
+	var divergenceErr *core.DivergenceError
+	if !errors.As(err, &divergenceErr) {
+		t.Fatalf("Expected a *DivergenceError, got %v", err)
+	}
+
+	if divergenceErr.Entry.Source != "completed:deploy/waitLoopUntil" || len(divergenceErr.Destinations) != 1 || divergenceErr.Destinations[0] != "start:deploy/validate" {
+		t.Fatalf("Unexpected divergence %v", divergenceErr)
+	}
+}
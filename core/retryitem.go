@@ -16,11 +16,12 @@ func (rt *retriableTransition) Source() Event {
 }
 
 // Destination evaluates the wrapped transition and handles any errors by consulting the error handler.
+// Failures of the retried item, raised as failure events, are handled the same way.
 func (rt *retriableTransition) Destination(ctx context.Context) ([]Event, error) {
 	events, err := rt.transition.Destination(ctx)
 	if err != nil {
 		// If there's an error, consult the error handler.
-		shouldRetry, errorHandlerErr := rt.errorHandlerFunc(ctx, err)
+		shouldRetry, errorHandlerErr := rt.shouldRetry(ctx, err)
 		if errorHandlerErr != nil {
 			// If the error handler itself fails, propagate that error.
 			return nil, errorHandlerErr
@@ -28,6 +29,7 @@ func (rt *retriableTransition) Destination(ctx context.Context) ([]Event, error)
 
 		if shouldRetry {
 			// If we should retry, transition to the retry event.
+			recordHandledFailure(ctx, err)
 			return []Event{rt.retryEvent}, nil
 		} else {
 			// Otherwise, propagate the original error.
@@ -35,10 +37,32 @@ func (rt *retriableTransition) Destination(ctx context.Context) ([]Event, error)
 		}
 	}
 
+	if containsEvent(events, FailedEvent(rt.retryEvent.Scope())) {
+		// If the item failed, consult the error handler with the recorded failure.
+		failure := currentFailure(ctx, rt.retryEvent.Scope())
+		shouldRetry, errorHandlerErr := rt.shouldRetry(ctx, failure)
+		if errorHandlerErr != nil {
+			return nil, errorHandlerErr
+		}
+
+		if shouldRetry {
+			recordHandledFailure(ctx, failure)
+			clearFailure(ctx)
+			return []Event{rt.retryEvent}, nil
+		}
+	}
+
 	// If there's no error, proceed normally
 	return events, err
 }
 
+// shouldRetry consults the error handler, recovering its panics.
+func (rt *retriableTransition) shouldRetry(ctx context.Context, err error) (bool, error) {
+	return callWithRecover(ctx, rt.retryEvent.Scope(), func() (bool, error) {
+		return rt.errorHandlerFunc(ctx, err)
+	})
+}
+
 // IsExclusive delegates to the wrapped transition.
 func (rt *retriableTransition) IsExclusive() bool {
 	return rt.transition.IsExclusive()
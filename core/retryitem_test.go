@@ -133,7 +133,7 @@ func TestRetriableTransition_NoRetry(t *testing.T) {
 	_, err = sf.Apply(context.Background(), nil)
 
 	// Check the error
-	if err != expectedErr {
+	if !errors.Is(err, expectedErr) {
 		t.Fatalf("Expected error %v, got %v", expectedErr, err)
 	}
 }
@@ -163,7 +163,7 @@ func TestRetriableTransition_ErrorHandlerError(t *testing.T) {
 	_, err = sf.Apply(context.Background(), nil)
 
 	// Check the error - should be the handler error, not the function error
-	if err != handlerErr {
+	if !errors.Is(err, handlerErr) {
 		t.Fatalf("Expected error %v, got %v", handlerErr, err)
 	}
 }
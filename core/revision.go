@@ -0,0 +1,40 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrConflict is returned by CheckRevision when the stored state was changed by another Apply call.
+var ErrConflict = errors.New("state revision conflict")
+
+// revisionKey is the state metadata key holding the state revision.
+const revisionKey = "revision"
+
+// Revision returns the revision of the state, which is incremented by every StepFlow.Apply call, see WithRevision.
+// States without a revision have revision 0.
+func (s State) Revision() uint64 {
+	revision, _ := strconv.ParseUint(s.Metadata[revisionKey], 10, 64)
+	return revision
+}
+
+// nextRevision increments the revision of the state, if revisions are enabled or the state already has a revision.
+func (sf *stepFlowImpl) nextRevision(state *State) {
+	if _, found := state.Metadata[revisionKey]; !found && !sf.options.revision {
+		return
+	}
+
+	state.SetMetadata(revisionKey, strconv.FormatUint(state.Revision()+1, 10))
+}
+
+// CheckRevision returns ErrConflict unless the next state was applied from the stored state, i.e. unless the next
+// revision directly follows the stored revision. Stores call it, or perform the equivalent conditional write,
+// before replacing the stored state, so that two workers applying the same instance cannot both commit.
+func CheckRevision(stored State, next State) error {
+	if next.Revision() != stored.Revision()+1 {
+		return fmt.Errorf("%w: stored revision %d, next revision %d", ErrConflict, stored.Revision(), next.Revision())
+	}
+
+	return nil
+}
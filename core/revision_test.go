@@ -0,0 +1,59 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestRevision(t *testing.T) {
+	calls := 0
+	sf, err := core.NewStepFlow(core.NewStepsItem("deploy", []core.StepFlowItem{
+		core.NewFuncItem("prepare", func(ctx context.Context) error { return nil }),
+		core.NewFuncItem("deploy", func(ctx context.Context) error {
+			calls++
+			return nil
+		}),
+	}), core.WithRevision(true))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	// The revision is incremented by every Apply call
+	stored, err := sf.ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	if stored.Revision() != 1 {
+		t.Fatalf("Expected revision 1, got %d", stored.Revision())
+	}
+
+	// Two workers apply the same instance without a lock
+	first, err := sf.ApplyState(context.Background(), stored)
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	second, err := sf.ApplyState(context.Background(), stored)
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	if calls != 2 || first.Revision() != 2 || second.Revision() != 2 {
+		t.Fatalf("Expected both workers to apply revision 2, got %d and %d", first.Revision(), second.Revision())
+	}
+
+	// The first worker commits
+	if err := core.CheckRevision(stored, first); err != nil {
+		t.Fatalf("CheckRevision returned an error: %v", err)
+	}
+	stored = first
+
+	// The second worker detects the conflict
+	if err := core.CheckRevision(stored, second); !errors.Is(err, core.ErrConflict) {
+		t.Fatalf("Expected ErrConflict, got %v", err)
+	}
+}
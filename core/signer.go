@@ -0,0 +1,76 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// ErrInvalidSignature is returned by StepFlow.Apply for states whose signature does not verify, see WithStateSigner.
+var ErrInvalidSignature = errors.New("invalid state signature")
+
+// signatureKey is the state metadata key holding the state signature.
+const signatureKey = "signature"
+
+// signature computes the HMAC-SHA256 of the definition fingerprint and of the binary encoding of the state,
+// excluding the signature itself.
+func (sf *stepFlowImpl) signature(state State) ([]byte, error) {
+	unsigned := state.Clone()
+	delete(unsigned.Metadata, signatureKey)
+
+	data, err := unsigned.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, sf.options.signingKey)
+	mac.Write([]byte(sf.fingerprint))
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// signState stores the signature of the state in its metadata, if a signing key is configured.
+func (sf *stepFlowImpl) signState(state *State) error {
+	if sf.options.signingKey == nil {
+		return nil
+	}
+
+	signature, err := sf.signature(*state)
+	if err != nil {
+		return err
+	}
+
+	state.SetMetadata(signatureKey, base64.RawURLEncoding.EncodeToString(signature))
+	return nil
+}
+
+// verifyState returns ErrInvalidSignature if a signing key is configured and the state signature does not verify.
+// Empty states, which start a new workflow instance, do not need to be signed. Any other state must be signed,
+// as its metadata and data, e.g. variables, drive the workflow as much as its events.
+func (sf *stepFlowImpl) verifyState(state State) error {
+	if sf.options.signingKey == nil {
+		return nil
+	}
+
+	encoded, found := state.Metadata[signatureKey]
+	if !found && len(state.Events) == 0 && len(state.Metadata) == 0 && len(state.Data) == 0 {
+		return nil
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || !found {
+		return ErrInvalidSignature
+	}
+
+	expected, err := sf.signature(state)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(signature, expected) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
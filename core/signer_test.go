@@ -0,0 +1,81 @@
+package core_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestStateSigner(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	items := []core.StepFlowItem{
+		core.NewWaitForItem("approvalWaitFor", func(ctx context.Context) (bool, error) { return false, nil }),
+		core.NewFuncItem("deploy", noop),
+	}
+	key := []byte("secret")
+
+	sf, err := core.NewStepFlow(core.NewStepsItem("deploy", items), core.WithStateSigner(key))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	state, err := sf.ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	if state.Metadata["signature"] == "" {
+		t.Fatalf("Expected a signed state, got %+v", state)
+	}
+
+	// The signature survives serialization
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Marshal returned an error: %v", err)
+	}
+
+	var decoded core.State
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal returned an error: %v", err)
+	}
+
+	if _, err := sf.ApplyState(context.Background(), decoded); err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	// A forged event skipping the approval is refused
+	forged := decoded.Clone()
+	forged.Events = []string{"completed:deploy/approvalWaitFor"}
+	if _, err := sf.ApplyState(context.Background(), forged); !errors.Is(err, core.ErrInvalidSignature) {
+		t.Fatalf("Expected ErrInvalidSignature, got %v", err)
+	}
+
+	// Unsigned states are refused, unless they are empty
+	if _, err := sf.Apply(context.Background(), []string{"completed:deploy/approvalWaitFor"}); !errors.Is(err, core.ErrInvalidSignature) {
+		t.Fatalf("Expected ErrInvalidSignature, got %v", err)
+	}
+
+	// Unsigned states are refused even without events, if they carry any metadata or data
+	forgedData := core.State{Data: map[string]json.RawMessage{"vars": json.RawMessage(`{"approved":true}`)}}
+	if _, err := sf.ApplyState(context.Background(), forgedData); !errors.Is(err, core.ErrInvalidSignature) {
+		t.Fatalf("Expected ErrInvalidSignature, got %v", err)
+	}
+
+	forgedMetadata := core.State{Metadata: map[string]string{"revision": "7"}}
+	if _, err := sf.ApplyState(context.Background(), forgedMetadata); !errors.Is(err, core.ErrInvalidSignature) {
+		t.Fatalf("Expected ErrInvalidSignature, got %v", err)
+	}
+
+	// The signature covers the definition fingerprint
+	other, err := core.NewStepFlow(core.NewStepsItem("deploy", items[:1]), core.WithStateSigner(key))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	if _, err := other.ApplyState(context.Background(), decoded); !errors.Is(err, core.ErrInvalidSignature) {
+		t.Fatalf("Expected ErrInvalidSignature, got %v", err)
+	}
+}
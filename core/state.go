@@ -0,0 +1,274 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// StateVersion is the current schema version of State.
+const StateVersion = 1
+
+// State is the structured state of a workflow instance.
+// Besides the active events, it holds instance metadata, like timestamps and failure details,
+// and an extensible data section for features that need to persist values, keyed by feature.
+type State struct {
+	// Version is the schema version of the state. The zero value is read as the current version.
+	Version int `json:"version"`
+
+	// Events holds the active events, as "name:scope" strings.
+	Events []string `json:"events"`
+
+	// Metadata holds instance metadata as string values.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Data holds JSON encoded values.
+	Data map[string]json.RawMessage `json:"data,omitempty"`
+}
+
+// stateJSON is used to marshal State with the default JSON encoding.
+type stateJSON State
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s State) MarshalJSON() ([]byte, error) {
+	s.Version = StateVersion
+	return json.Marshal(stateJSON(s))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *State) UnmarshalJSON(data []byte) error {
+	var decoded stateJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	if err := checkStateVersion(decoded.Version); err != nil {
+		return err
+	}
+
+	*s = State(decoded)
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+// The binary encoding is a sequence of uvarint lengths and values: version, events, sorted metadata and sorted data.
+func (s State) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	writeUvarint(&buf, StateVersion)
+
+	writeUvarint(&buf, uint64(len(s.Events)))
+	for _, event := range s.Events {
+		writeString(&buf, event)
+	}
+
+	writeUvarint(&buf, uint64(len(s.Metadata)))
+	for _, key := range slices.Sorted(maps.Keys(s.Metadata)) {
+		writeString(&buf, key)
+		writeString(&buf, s.Metadata[key])
+	}
+
+	writeUvarint(&buf, uint64(len(s.Data)))
+	for _, key := range slices.Sorted(maps.Keys(s.Data)) {
+		writeString(&buf, key)
+		writeString(&buf, string(s.Data[key]))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (s *State) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	var decoded State
+
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("invalid state: %w", err)
+	}
+
+	if err := checkStateVersion(int(version)); err != nil {
+		return err
+	}
+	decoded.Version = int(version)
+
+	eventsLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("invalid state: %w", err)
+	}
+
+	for range eventsLen {
+		event, err := readString(r)
+		if err != nil {
+			return err
+		}
+		decoded.Events = append(decoded.Events, event)
+	}
+
+	metadataLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("invalid state: %w", err)
+	}
+
+	for range metadataLen {
+		key, err := readString(r)
+		if err != nil {
+			return err
+		}
+
+		value, err := readString(r)
+		if err != nil {
+			return err
+		}
+
+		decoded.SetMetadata(key, value)
+	}
+
+	dataLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("invalid state: %w", err)
+	}
+
+	for range dataLen {
+		key, err := readString(r)
+		if err != nil {
+			return err
+		}
+
+		value, err := readString(r)
+		if err != nil {
+			return err
+		}
+
+		decoded.SetData(key, json.RawMessage(value))
+	}
+
+	if r.Len() != 0 {
+		return errors.New("invalid state: trailing data")
+	}
+
+	*s = decoded
+	return nil
+}
+
+// writeUvarint writes v as an uvarint.
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	buf.Write(binary.AppendUvarint(nil, v))
+}
+
+// writeString writes the length of str followed by str.
+func writeString(buf *bytes.Buffer, str string) {
+	writeUvarint(buf, uint64(len(str)))
+	buf.WriteString(str)
+}
+
+// readString reads a string written by writeString.
+func readString(r *bytes.Reader) (string, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", fmt.Errorf("invalid state: %w", err)
+	}
+
+	if length > uint64(r.Len()) {
+		return "", errors.New("invalid state: truncated data")
+	}
+
+	str := make([]byte, length)
+	_, _ = r.Read(str)
+	return string(str), nil
+}
+
+// checkStateVersion returns an error if the given schema version is not supported.
+func checkStateVersion(version int) error {
+	if version < 0 || version > StateVersion {
+		return fmt.Errorf("unsupported state version %d", version)
+	}
+
+	return nil
+}
+
+// SetMetadata sets a metadata value, allocating the metadata map if needed.
+func (s *State) SetMetadata(key string, value string) {
+	if s.Metadata == nil {
+		s.Metadata = make(map[string]string)
+	}
+
+	s.Metadata[key] = value
+}
+
+// SetData sets a data value, allocating the data map if needed.
+func (s *State) SetData(key string, value json.RawMessage) {
+	if s.Data == nil {
+		s.Data = make(map[string]json.RawMessage)
+	}
+
+	s.Data[key] = value
+}
+
+// Clone returns a deep copy of the state.
+func (s State) Clone() State {
+	clone := State{Version: s.Version, Events: slices.Clone(s.Events)}
+	if s.Metadata != nil {
+		clone.Metadata = maps.Clone(s.Metadata)
+	}
+
+	if s.Data != nil {
+		clone.Data = make(map[string]json.RawMessage, len(s.Data))
+		for key, value := range s.Data {
+			clone.Data[key] = slices.Clone(value)
+		}
+	}
+
+	return clone
+}
+
+const (
+	// metadataPrefix marks the string state entries that hold metadata, as "@key=value".
+	metadataPrefix = "@"
+
+	// dataPrefix marks the string state entries that hold data, as "$key=json".
+	dataPrefix = "$"
+)
+
+// StateFromStrings converts a []string state, as used by StepFlow.Apply, to a State.
+// Entries prefixed with "@" hold metadata, entries prefixed with "$" hold data and all the others are events.
+func StateFromStrings(state []string) State {
+	var result State
+	for _, entry := range state {
+		key, value, found := strings.Cut(entry, "=")
+		switch {
+		case found && strings.HasPrefix(key, metadataPrefix):
+			result.SetMetadata(strings.TrimPrefix(key, metadataPrefix), value)
+		case found && strings.HasPrefix(key, dataPrefix):
+			result.SetData(strings.TrimPrefix(key, dataPrefix), json.RawMessage(value))
+		default:
+			result.Events = append(result.Events, entry)
+		}
+	}
+
+	return result
+}
+
+// Strings converts the state to the []string representation used by StepFlow.Apply.
+// The events come first, followed by the metadata and data entries sorted by key.
+// It returns nil if there are no events.
+func (s State) Strings() []string {
+	if len(s.Events) == 0 {
+		return nil
+	}
+
+	result := slices.Clone(s.Events)
+	for _, key := range slices.Sorted(maps.Keys(s.Metadata)) {
+		result = append(result, metadataPrefix+key+"="+s.Metadata[key])
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(s.Data)) {
+		result = append(result, dataPrefix+key+"="+string(s.Data[key]))
+	}
+
+	return result
+}
@@ -0,0 +1,138 @@
+package core_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func testState() core.State {
+	return core.State{
+		Version:  core.StateVersion,
+		Events:   []string{"start:steps/child"},
+		Metadata: map[string]string{"startedAt": "2026-01-01T00:00:00Z"},
+		Data:     map[string]json.RawMessage{"vars": json.RawMessage(`{"imageTag":"v1"}`)},
+	}
+}
+
+func TestState_JSON(t *testing.T) {
+	state := testState()
+
+	// Marshal and unmarshal the state
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Marshal returned an error: %v", err)
+	}
+
+	expectedJSON := `{"version":1,"events":["start:steps/child"],"metadata":{"startedAt":"2026-01-01T00:00:00Z"},"data":{"vars":{"imageTag":"v1"}}}`
+	if string(data) != expectedJSON {
+		t.Fatalf("Expected JSON %s, got %s", expectedJSON, data)
+	}
+
+	var decoded core.State
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal returned an error: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, state) {
+		t.Fatalf("Expected state %+v, got %+v", state, decoded)
+	}
+}
+
+func TestState_JSON_UnsupportedVersion(t *testing.T) {
+	var decoded core.State
+	err := json.Unmarshal([]byte(`{"version":99,"events":["start:steps"]}`), &decoded)
+	if err == nil {
+		t.Fatal("Expected an error for an unsupported version")
+	}
+}
+
+func TestState_Binary(t *testing.T) {
+	state := testState()
+
+	// Marshal and unmarshal the state
+	data, err := state.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary returned an error: %v", err)
+	}
+
+	var decoded core.State
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary returned an error: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, state) {
+		t.Fatalf("Expected state %+v, got %+v", state, decoded)
+	}
+
+	// Truncated data is rejected
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("Expected an error for truncated data")
+	}
+}
+
+func TestState_Strings(t *testing.T) {
+	state := testState()
+
+	// Convert the state to strings and back
+	strings := state.Strings()
+	expectedStrings := []string{"start:steps/child", "@startedAt=2026-01-01T00:00:00Z", `$vars={"imageTag":"v1"}`}
+	if !reflect.DeepEqual(strings, expectedStrings) {
+		t.Fatalf("Expected strings %s, got %s", expectedStrings, strings)
+	}
+
+	decoded := core.StateFromStrings(strings)
+	decoded.Version = core.StateVersion
+	if !reflect.DeepEqual(decoded, state) {
+		t.Fatalf("Expected state %+v, got %+v", state, decoded)
+	}
+}
+
+func TestStepFlow_ApplyState(t *testing.T) {
+	// Create a step flow with a single function item
+	item := core.NewStepsItem("steps", []core.StepFlowItem{
+		core.NewFuncItem("child", func(ctx context.Context) error {
+			return nil
+		}),
+	})
+
+	sf, err := core.NewStepFlow(item)
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Apply the step flow on the structured state
+	state := testState()
+	newState, err := sf.ApplyState(context.Background(), state)
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	// Check that the data section is kept
+	if string(newState.Data["vars"]) != `{"imageTag":"v1"}` {
+		t.Fatalf("Unexpected data %s", newState.Data)
+	}
+
+	// Check that the given state is not modified
+	if state.Events[0] != "start:steps/child" {
+		t.Fatalf("Unexpected state %s", state.Events)
+	}
+
+	newState, err = sf.ApplyState(context.Background(), newState)
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	if !sf.IsCompleted(newState.Events) {
+		t.Fatalf("Unexpected state %s", newState.Events)
+	}
+
+	// Unsupported versions are rejected
+	_, err = sf.ApplyState(context.Background(), core.State{Version: core.StateVersion + 1})
+	if err == nil {
+		t.Fatal("Expected an error for an unsupported version")
+	}
+}
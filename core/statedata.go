@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+)
+
+// StateData binds a value to a state data key for the duration of an Apply call, see WithStateData.
+type StateData interface {
+	// Load decodes the value from the state data. It is not called if the state holds no value for the key.
+	Load(data json.RawMessage) error
+
+	// Save encodes the value into the state data.
+	Save() (json.RawMessage, error)
+}
+
+// stateDataContextKey is the context key used to pass the state data bindings to StepFlow.ApplyState.
+type stateDataContextKey struct{}
+
+// WithStateData returns a copy of ctx that binds data to the given state data key in StepFlow.ApplyState.
+// The data is loaded once the state is decoded, before any step function is called, and saved into
+// the returned state, before it is encrypted and signed.
+func WithStateData(ctx context.Context, key string, data StateData) context.Context {
+	bindings := maps.Clone(stateDataFromContext(ctx))
+	if bindings == nil {
+		bindings = make(map[string]StateData)
+	}
+	bindings[key] = data
+
+	return context.WithValue(ctx, stateDataContextKey{}, bindings)
+}
+
+// stateDataFromContext returns the state data bindings carried by ctx.
+func stateDataFromContext(ctx context.Context) map[string]StateData {
+	bindings, _ := ctx.Value(stateDataContextKey{}).(map[string]StateData)
+	return bindings
+}
+
+// loadStateData loads the bound values from the state data.
+func loadStateData(ctx context.Context, state *State) error {
+	for key, data := range stateDataFromContext(ctx) {
+		if value, found := state.Data[key]; found {
+			if err := data.Load(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// saveStateData saves the bound values into the state data.
+func saveStateData(ctx context.Context, state *State) error {
+	for key, data := range stateDataFromContext(ctx) {
+		value, err := data.Save()
+		if err != nil {
+			return err
+		}
+
+		state.SetData(key, value)
+	}
+
+	return nil
+}
@@ -2,33 +2,99 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 )
 
 // StepFlow represents an executable workflow. It applies transitions to move from one state to another.
 type StepFlow interface {
 	// Apply executes the workflow from the given state, returning the new state and any error.
+	// It is an adapter of ApplyState for states stored as []string, see StateFromStrings.
 	Apply(ctx context.Context, state []string) ([]string, error)
 
+	// ApplyState executes the workflow from the given structured state, returning the new state and any error.
+	ApplyState(ctx context.Context, state State) (State, error)
+
 	// IsCompleted checks if the workflow has reached its completion state.
 	IsCompleted(state []string) bool
+
+	// ValidateState checks the given state against the workflow definition without applying it.
+	// It returns one diagnostic per problem found, or nil if the state can be applied.
+	ValidateState(state State) []Diagnostic
+
+	// Fingerprint returns a stable fingerprint of the workflow definition, computed from its scopes,
+	// transitions and possible destinations. The versions of versioned items are fingerprinted separately.
+	Fingerprint() string
+
+	// CompactState converts the given state to its compact form, in which scope names are replaced with short ids.
+	CompactState(state State) (State, error)
+
+	// ExpandState converts a state returned by CompactState back to its readable form.
+	ExpandState(state State) (State, error)
+
+	// History returns the execution history recorded in the given state, decrypting its data first, see WithHistory.
+	History(state State) ([]HistoryEntry, error)
+
+	// MoveTo returns a copy of the state in which the step of the given scope starts, e.g. "deploy/validate".
+	MoveTo(state State, scope string) (State, error)
+
+	// Skip returns a copy of the state in which the step of the given scope is completed without running it.
+	Skip(state State, scope string) (State, error)
+
+	// RestartScope returns a copy of the state in which the group of steps of the given scope starts again.
+	RestartScope(state State, scope string) (State, error)
 }
 
 // stepFlowImpl implements the StepFlow interface and manages the execution of a workflow.
 type stepFlowImpl struct {
 	item           StepFlowItem
+	scope          Scope
 	transitionsMap map[string][]Transition
 	startState     []string
 	completedState []string
+	timedOutState  []string
+	failedState    []string
+	handlerScope   Scope
+	fingerprint    string
+	versionScopes  []string
+	versions       map[string]map[int]string
+	dictionary     scopeDictionary
+	options        options
 }
 
 // NewStepFlow creates a new executable workflow using the provided step flow item as a root item.
-func NewStepFlow(item StepFlowItem) (StepFlow, error) {
+func NewStepFlow(item StepFlowItem, opts ...Option) (StepFlow, error) {
 	itemScope, transitions, err := item.Transitions(nil)
 	if err != nil {
 		return nil, err
 	}
 
+	o := newOptions(opts)
+	if err := checkStateLimits(o); err != nil {
+		return nil, err
+	}
+
+	// Add the deadline handler transitions, if any. The handler completes in the timed-out state.
+	var handlerScope Scope
+	if o.deadlineHandler != nil {
+		var handlerTransitions []Transition
+		handlerScope, handlerTransitions, err = o.deadlineHandler.Transitions(itemScope)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range transitions {
+			if isSameOrParentScope(handlerScope.Name(), t.Source().Scope().Name()) {
+				return nil, fmt.Errorf("deadline handler %s conflicts with the step of the same name, rename the step", handlerScope.Name())
+			}
+		}
+
+		transitions = append(transitions, handlerTransitions...)
+		transitions = append(transitions, NewStaticTransition(CompletedEvent(handlerScope), TimedOutEvent(itemScope)))
+		transitions = append(transitions, reRaiseFailure(handlerScope))
+	}
+
 	transitionsMap := make(map[string][]Transition)
 	for _, t := range transitions {
 		source := eventString(t.Source())
@@ -42,8 +108,27 @@ func NewStepFlow(item StepFlowItem) (StepFlow, error) {
 
 	startState := []string{eventString(StartCommand(itemScope))}
 	completedState := []string{eventString(CompletedEvent(itemScope))}
+	timedOutState := []string{eventString(TimedOutEvent(itemScope))}
+	failedState := []string{eventString(FailedEvent(itemScope))}
+	versionScopes := versionScopeNames(transitionsMap)
+
+	sf := &stepFlowImpl{
+		item:           item,
+		scope:          itemScope,
+		transitionsMap: transitionsMap,
+		startState:     startState,
+		completedState: completedState,
+		timedOutState:  timedOutState,
+		failedState:    failedState,
+		handlerScope:   handlerScope,
+		fingerprint:    fingerprint(transitionsMap, versionScopes, ""),
+		versionScopes:  versionScopes,
+		versions:       versionFingerprints(transitionsMap, versionScopes),
+		options:        o,
+	}
+	sf.dictionary = sf.newDictionary()
 
-	return &stepFlowImpl{item: item, transitionsMap: transitionsMap, startState: startState, completedState: completedState}, nil
+	return sf, nil
 }
 
 // ApplyOneMaxIterations limits the maximum number of state transitions in a single Apply call
@@ -51,27 +136,194 @@ func NewStepFlow(item StepFlowItem) (StepFlow, error) {
 const ApplyOneMaxIterations = 100
 
 // Apply executes the workflow starting from the given state (or the default start state if nil).
+// The state is converted with StateFromStrings and State.Strings.
+func (sf *stepFlowImpl) Apply(ctx context.Context, oldState []string) ([]string, error) {
+	newState, err := sf.ApplyState(ctx, StateFromStrings(oldState))
+	return newState.Strings(), err
+}
+
+// ApplyState executes the workflow starting from the given state (or the default start state if it has no events).
 // It repeatedly applies transitions until an error occurs, an exclusive transition is encountered,
 // or the maximum number of iterations is reached.
-func (sf *stepFlowImpl) Apply(ctx context.Context, oldState []string) ([]string, error) {
-	newState := withDefaultValue(oldState, sf.startState)
+// Failure events are propagated within the same Apply call, so that the items handling them see the original error.
+// Transition failures are returned as *StepError.
+func (sf *stepFlowImpl) ApplyState(ctx context.Context, oldState State) (State, error) {
+	if err := checkStateVersion(oldState.Version); err != nil {
+		return State{}, err
+	}
+
+	if err := sf.verifyState(oldState); err != nil {
+		return State{}, err
+	}
+
+	if err := sf.checkFingerprint(oldState.Metadata); err != nil {
+		return State{}, err
+	}
+
+	oldState, err := sf.ExpandState(oldState)
+	if err != nil {
+		return State{}, err
+	}
+
+	state := oldState.Clone()
+	state.Version = StateVersion
+	if state.Metadata == nil {
+		state.Metadata = make(map[string]string)
+	}
+
+	if sf.options.fingerprint {
+		state.Metadata[fingerprintKey] = sf.fingerprint
+	}
+
+	if err := sf.decryptData(&state); err != nil {
+		return State{}, err
+	}
+
+	if err := loadStateData(ctx, &state); err != nil {
+		return State{}, err
+	}
+
+	ctx = withOptions(ctx, sf.options)
+	newState := sf.applyDeadline(withDefaultValue(state.Events, sf.startState), state.Metadata)
+	ctx, failures, err := withFailureRecorder(ctx, state)
+	if err != nil {
+		return State{}, err
+	}
+
+	ctx, vars, err := withVariables(ctx, &state, varsKey)
+	if err != nil {
+		return State{}, err
+	}
+
+	ctx, outputs, err := withVariables(ctx, &state, outputsKey)
+	if err != nil {
+		return State{}, err
+	}
+
+	ctx, versions, err := withVariables(ctx, &state, versionsKey)
+	if err != nil {
+		return State{}, err
+	}
+
+	if err := sf.checkVersions(versions); err != nil {
+		return State{}, err
+	}
+
+	history, err := newHistory(state, sf.options)
+	if err != nil {
+		return State{}, err
+	}
+
+	ctx, attempts, err := withVariables(ctx, &state, attemptsKey)
+	if err != nil {
+		return State{}, err
+	}
+
+	ctx, continueAsNew := withContinueAsNewRequest(ctx)
 	var isExclusive bool
-	var err error
 
 	for range ApplyOneMaxIterations {
-		newState, isExclusive, err = sf.applyOne(ctx, newState)
-		if err != nil || isExclusive {
+		wasFailed := isFailedState(newState)
+		newState, isExclusive, err = sf.applyOne(ctx, newState, history)
+		continueAsNew.continueAsNew(ctx, state.Metadata, vars, history, outputs, versions, attempts)
+		if err != nil || sf.isFinal(newState) {
+			break
+		}
+
+		if isFailedState(newState) {
+			continue
+		}
+
+		if isExclusive || wasFailed {
 			break
 		}
 	}
 
-	return newState, err
+	if err != nil {
+		return State{}, err
+	}
+
+	// Exceeded limits are returned with the new state, as its step functions have already been called.
+	var limitErrs []error
+	limitErrs = append(limitErrs, sf.limitEvents(newState))
+
+	if err := failures.save(&state, sf.options.cipher != nil); err != nil {
+		return State{}, err
+	}
+
+	oldVars := state.Data[varsKey]
+	if err := vars.save(&state); err != nil {
+		return State{}, err
+	}
+
+	limitErrs = append(limitErrs, sf.limitVariables(&state, oldVars))
+
+	if err := outputs.save(&state); err != nil {
+		return State{}, err
+	}
+
+	if err := sf.checkVersions(versions); err != nil {
+		return State{}, err
+	}
+
+	if err := versions.save(&state); err != nil {
+		return State{}, err
+	}
+
+	if sf.isFinal(newState) || !sf.options.attempts {
+		for _, name := range attempts.Names() {
+			attempts.Delete(name)
+		}
+	}
+
+	if err := attempts.save(&state); err != nil {
+		return State{}, err
+	}
+
+	limitErrs = append(limitErrs, sf.limitHistory(history))
+
+	if err := history.save(&state); err != nil {
+		return State{}, err
+	}
+
+	if err := saveStateData(ctx, &state); err != nil {
+		return State{}, err
+	}
+
+	state.Events = newState
+	sf.nextRevision(&state)
+
+	if err := sf.encryptData(&state); err != nil {
+		return State{}, err
+	}
+
+	if sf.options.compactState {
+		if state, err = sf.CompactState(state); err != nil {
+			return State{}, err
+		}
+	}
+
+	if err := sf.signState(&state); err != nil {
+		return State{}, err
+	}
+
+	switch {
+	case slices.Equal(newState, sf.timedOutState):
+		err = ErrDeadlineExceeded
+	case slices.Equal(newState, sf.failedState):
+		err = currentFailure(ctx, sf.scope)
+	default:
+		err = errors.Join(limitErrs...)
+	}
+
+	return state, err
 }
 
 // applyOne performs a single transition from the current state to the next state.
 // It returns the new state, whether the transition is exclusive, and any error that occurred.
-func (sf *stepFlowImpl) applyOne(ctx context.Context, oldState []string) ([]string, bool, error) {
-	if sf.IsCompleted(oldState) {
+// Applied transitions are recorded in the history, if enabled.
+func (sf *stepFlowImpl) applyOne(ctx context.Context, oldState []string, history *history) ([]string, bool, error) {
+	if sf.isFinal(oldState) {
 		return oldState, true, nil
 	}
 
@@ -79,16 +331,22 @@ func (sf *stepFlowImpl) applyOne(ctx context.Context, oldState []string) ([]stri
 		for _, t := range sf.transitionsMap[lastEvent] {
 			isExclusive := t.IsExclusive()
 			newState, err := t.Destination(ctx)
-			return eventsString(newState), isExclusive, err
+			if err != nil {
+				return eventsString(newState), isExclusive, newStepError(t, currentAttempt(ctx, t.Source()), err)
+			}
+
+			history.record(ctx, t, newState)
+
+			return eventsString(newState), isExclusive, nil
 		}
 	}
 
 	return nil, true, fmt.Errorf("unhandled state %s", oldState)
 }
 
-// withDefaultValue returns the default value if the given value is nil, otherwise returns the value.
+// withDefaultValue returns the default value if the given value is empty, otherwise returns the value.
 func withDefaultValue(value []string, defaultValue []string) []string {
-	if value == nil {
+	if len(value) == 0 {
 		return defaultValue
 	}
 
@@ -97,11 +355,13 @@ func withDefaultValue(value []string, defaultValue []string) []string {
 
 // IsCompleted checks if the workflow has reached its completion state.
 func (sf *stepFlowImpl) IsCompleted(state []string) bool {
-	if len(state) != 1 {
-		return false
-	}
+	expanded, err := sf.ExpandState(StateFromStrings(state))
+	return err == nil && slices.Equal(expanded.Events, sf.completedState)
+}
 
-	return state[0] == sf.completedState[0]
+// isFinal checks if the given events are either the completed, the timed-out or the failed state.
+func (sf *stepFlowImpl) isFinal(events []string) bool {
+	return slices.Equal(events, sf.completedState) || slices.Equal(events, sf.timedOutState) || slices.Equal(events, sf.failedState)
 }
 
 // Scope represents a named context in which events occur. Scopes can be nested to allow hierarchical structures.
@@ -120,6 +380,7 @@ type scopeImpl struct {
 }
 
 // NewScope creates a new root scope with the given name
+// The name is used as is, so names with reserved characters are escaped by the caller, see EscapeName.
 func NewScope(name string) Scope {
 	return &scopeImpl{name: name}
 }
@@ -198,6 +459,11 @@ func CompletedEvent(scope Scope) Event {
 	return NewEvent("completed", scope)
 }
 
+// TimedOutEvent creates a "timedOut" event for the given scope.
+func TimedOutEvent(scope Scope) Event {
+	return NewEvent("timedOut", scope)
+}
+
 // StepFlowItem is the base interface for all workflow components.
 // Each item defines its transitions within a parent scope.
 type StepFlowItem interface {
@@ -308,8 +574,20 @@ func (t *dynamicTransition) Source() Event {
 }
 
 // Destination implements the Transition interface.
+// Panics raised by the destination function are recovered as *StepPanicError, unless disabled with WithPanicRecovery.
+// When failure events are enabled, errors are recorded and a FailedEvent of the source scope is returned instead.
+// Consecutive failures are counted in the state, see StepError.Attempt.
 func (t *dynamicTransition) Destination(ctx context.Context) ([]Event, error) {
-	return t.destinationFunc(ctx)
+	events, err := callWithRecover(ctx, t.source.Scope(), func() ([]Event, error) {
+		return t.destinationFunc(ctx)
+	})
+	recordAttempt(ctx, t.source, err)
+	if err != nil && optionsFromContext(ctx).failureEvents {
+		recordFailure(ctx, t.source.Scope(), err)
+		return []Event{FailedEvent(t.source.Scope())}, nil
+	}
+
+	return events, err
 }
 
 // IsExclusive implements the Transition interface.
@@ -79,7 +79,7 @@ func TestStepFlow_Apply_Error(t *testing.T) {
 	_, err = sf.Apply(context.Background(), nil)
 
 	// Check that the error was returned
-	if err != expectedErr {
+	if !errors.Is(err, expectedErr) {
 		t.Fatalf("Expected error %v, got %v", expectedErr, err)
 	}
 }
@@ -174,3 +174,89 @@ func TestWithParent_NilParent(t *testing.T) {
 		t.Fatalf("Expected scope to be the same as child, got %v", scope)
 	}
 }
+
+func TestStepFlow_Apply_StepError(t *testing.T) {
+	// Create a nested step flow with a failing function item
+	expectedErr := errors.New("test error")
+	item := core.NewStepsItem("deploy", []core.StepFlowItem{
+		core.NewStepsItem("stepsRetry", []core.StepFlowItem{
+			core.NewFuncItem("validate", func(ctx context.Context) error {
+				return expectedErr
+			}),
+		}),
+	})
+
+	sf, err := core.NewStepFlow(item)
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Apply the step flow
+	_, err = sf.Apply(context.Background(), nil)
+
+	// Check that the error identifies the failing step
+	var stepErr *core.StepError
+	if !errors.As(err, &stepErr) {
+		t.Fatalf("Expected *core.StepError, got %T", err)
+	}
+
+	if stepErr.Scope != "deploy/stepsRetry/validate" {
+		t.Fatalf("Expected scope 'deploy/stepsRetry/validate', got '%s'", stepErr.Scope)
+	}
+
+	if stepErr.Event != "start:deploy/stepsRetry/validate" {
+		t.Fatalf("Expected event 'start:deploy/stepsRetry/validate', got '%s'", stepErr.Event)
+	}
+
+	if stepErr.Kind != core.DynamicTransitionKind {
+		t.Fatalf("Expected kind %s, got %s", core.DynamicTransitionKind, stepErr.Kind)
+	}
+
+	if stepErr.Attempt != 1 {
+		t.Fatalf("Expected attempt 1, got %d", stepErr.Attempt)
+	}
+
+	// Check that the original error is preserved
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("Expected error %v, got %v", expectedErr, err)
+	}
+}
+
+func TestStepFlow_Apply_StepErrorAttempt(t *testing.T) {
+	expectedErr := errors.New("test error")
+	retries := 0
+	item := core.NewStepsItem("deploy", []core.StepFlowItem{
+		core.NewRetryItem(core.NewStepsItem("stepsRetry", []core.StepFlowItem{
+			core.NewFuncItem("validate", func(ctx context.Context) error {
+				return expectedErr
+			}),
+		}), func(ctx context.Context, err error) (bool, error) {
+			retries++
+			return retries < 3, nil
+		}),
+	})
+
+	sf, err := core.NewStepFlow(item, core.WithAttempts(true))
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// Each retry is applied in a new Apply call
+	var state []string
+	for range 2 {
+		if state, err = sf.Apply(context.Background(), state); err != nil {
+			t.Fatalf("Apply returned an error: %v", err)
+		}
+	}
+
+	// The attempt counts the failures recorded in the state across Apply calls
+	_, err = sf.Apply(context.Background(), state)
+	var stepErr *core.StepError
+	if !errors.As(err, &stepErr) {
+		t.Fatalf("Expected *core.StepError, got %v", err)
+	}
+
+	if stepErr.Attempt != 3 {
+		t.Fatalf("Expected attempt 3, got %d", stepErr.Attempt)
+	}
+}
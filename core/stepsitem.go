@@ -46,6 +46,9 @@ func (si *stepsItem) Transitions(parent Scope) (Scope, []Transition, error) {
 		// Add all items transitions.
 		transitions = append(transitions, itemTransitions...)
 
+		// Re-raise the item's failures.
+		transitions = append(transitions, reRaiseFailure(itemScope))
+
 		// The next item will start when this one completes.
 		lastEvent = CompletedEvent(itemScope)
 	}
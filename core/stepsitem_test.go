@@ -75,14 +75,16 @@ func TestStepsItem_WithItems(t *testing.T) {
 		t.Fatalf("Transitions returned an error: %v", err)
 	}
 
-	// We should have 5 transitions:
+	// We should have 7 transitions:
 	// 1. Start steps -> Start item1
 	// 2. Start item1 -> Completed item1 (from item1)
-	// 3. Completed item1 -> Start item2
-	// 4. Start item2 -> Completed item2 (from item2)
-	// 5. Completed item2 -> Completed steps
-	if len(transitions) != 5 {
-		t.Fatalf("Expected 5 transitions, got %d", len(transitions))
+	// 3. Failed item1 -> Failed steps
+	// 4. Completed item1 -> Start item2
+	// 5. Start item2 -> Completed item2 (from item2)
+	// 6. Failed item2 -> Failed steps
+	// 7. Completed item2 -> Completed steps
+	if len(transitions) != 7 {
+		t.Fatalf("Expected 7 transitions, got %d", len(transitions))
 	}
 }
 
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DiagnosticKind identifies the kind of problem found by StepFlow.ValidateState.
+type DiagnosticKind string
+
+const (
+	// UnsupportedVersionDiagnostic identifies states with an unsupported schema version.
+	UnsupportedVersionDiagnostic DiagnosticKind = "unsupportedVersion"
+
+	// FingerprintMismatchDiagnostic identifies states produced by an incompatible workflow definition, see WithFingerprint.
+	FingerprintMismatchDiagnostic DiagnosticKind = "fingerprintMismatch"
+
+	// InvalidSignatureDiagnostic identifies states whose signature does not verify, see WithStateSigner.
+	InvalidSignatureDiagnostic DiagnosticKind = "invalidSignature"
+
+	// InvalidEventDiagnostic identifies events that cannot be parsed, see ParseEvent.
+	InvalidEventDiagnostic DiagnosticKind = "invalidEvent"
+
+	// ForeignRootDiagnostic identifies events of a workflow with a different root name.
+	ForeignRootDiagnostic DiagnosticKind = "foreignRoot"
+
+	// UnknownEventDiagnostic identifies events that are not known to the workflow definition.
+	UnknownEventDiagnostic DiagnosticKind = "unknownEvent"
+
+	// DuplicateEventDiagnostic identifies events found more than once in the state.
+	DuplicateEventDiagnostic DiagnosticKind = "duplicateEvent"
+
+	// MixedScopesDiagnostic identifies events whose scopes cannot be active at the same time,
+	// i.e. events of the same scope or of a scope and one of its parent scopes.
+	MixedScopesDiagnostic DiagnosticKind = "mixedScopes"
+)
+
+// Diagnostic describes a problem found by StepFlow.ValidateState.
+type Diagnostic struct {
+	// Kind is the kind of the problem.
+	Kind DiagnosticKind
+
+	// Event is the event of the state the problem was found for, if any.
+	Event string
+
+	// Message is a human-readable description of the problem.
+	Message string
+}
+
+// String returns a human-readable representation of the diagnostic.
+func (d Diagnostic) String() string {
+	if d.Event == "" {
+		return fmt.Sprintf("%s: %s", d.Kind, d.Message)
+	}
+
+	return fmt.Sprintf("%s %s: %s", d.Kind, d.Event, d.Message)
+}
+
+// ValidateState checks the given state against the workflow definition without applying it.
+// It returns one diagnostic per problem found, or nil if the state can be applied.
+func (sf *stepFlowImpl) ValidateState(state State) []Diagnostic {
+	var diagnostics []Diagnostic
+	if err := checkStateVersion(state.Version); err != nil {
+		diagnostics = append(diagnostics, Diagnostic{Kind: UnsupportedVersionDiagnostic, Message: err.Error()})
+	}
+
+	if err := sf.verifyState(state); err != nil {
+		diagnostics = append(diagnostics, Diagnostic{Kind: InvalidSignatureDiagnostic, Message: err.Error()})
+	}
+
+	if err := sf.checkFingerprint(state.Metadata); err != nil {
+		diagnostics = append(diagnostics, Diagnostic{Kind: FingerprintMismatchDiagnostic, Message: err.Error()})
+	}
+
+	state, err := sf.ExpandState(state)
+	if errors.Is(err, ErrFingerprintMismatch) {
+		return append(diagnostics, Diagnostic{Kind: FingerprintMismatchDiagnostic, Message: err.Error()})
+	}
+
+	if err != nil {
+		return append(diagnostics, Diagnostic{Kind: InvalidEventDiagnostic, Message: err.Error()})
+	}
+
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, str := range state.Events {
+		if seen[str] {
+			diagnostics = append(diagnostics, Diagnostic{Kind: DuplicateEventDiagnostic, Event: str, Message: "duplicate event"})
+			continue
+		}
+		seen[str] = true
+
+		event, err := ParseEvent(str)
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{Kind: InvalidEventDiagnostic, Event: str, Message: err.Error()})
+			continue
+		}
+
+		if root := rootScope(event.Scope()); root.Name() != sf.scope.Name() {
+			diagnostics = append(diagnostics, Diagnostic{Kind: ForeignRootDiagnostic, Event: str,
+				Message: fmt.Sprintf("event of workflow %s, expected %s", root.Name(), sf.scope.Name())})
+			continue
+		}
+
+		if !sf.isKnownEvent(str) {
+			diagnostics = append(diagnostics, Diagnostic{Kind: UnknownEventDiagnostic, Event: str, Message: "event not known to the workflow definition"})
+			continue
+		}
+
+		for _, scope := range scopes {
+			if isSameOrParentScope(scope, event.Scope().Name()) || isSameOrParentScope(event.Scope().Name(), scope) {
+				diagnostics = append(diagnostics, Diagnostic{Kind: MixedScopesDiagnostic, Event: str,
+					Message: fmt.Sprintf("scope %s cannot be active together with scope %s", event.Scope().Name(), scope)})
+				break
+			}
+		}
+		scopes = append(scopes, event.Scope().Name())
+	}
+
+	return diagnostics
+}
+
+// isKnownEvent checks if the given event is the source of a transition or one of the terminal states.
+func (sf *stepFlowImpl) isKnownEvent(event string) bool {
+	if _, found := sf.transitionsMap[event]; found {
+		return true
+	}
+
+	return sf.isFinal([]string{event})
+}
+
+// rootScope returns the root scope of the given scope.
+func rootScope(scope Scope) Scope {
+	for scope.Parent() != nil {
+		scope = scope.Parent()
+	}
+
+	return scope
+}
+
+// isSameOrParentScope checks if the parent scope name is equal to, or a parent of, the scope name.
+func isSameOrParentScope(parent string, scope string) bool {
+	return parent == scope || strings.HasPrefix(scope, parent+scopeSeparator)
+}
@@ -0,0 +1,48 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestValidateState(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	sf, err := core.NewStepFlow(core.NewStepsItem("deploy", []core.StepFlowItem{
+		core.NewFuncItem("prepare", noop),
+		core.NewFuncItem("deploy", noop),
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create step flow: %v", err)
+	}
+
+	// Empty, in-flight and completed states are valid
+	for _, events := range [][]string{nil, {"start:deploy/prepare"}, {"completed:deploy/deploy"}, {"completed:deploy"}} {
+		if diagnostics := sf.ValidateState(core.StateFromStrings(events)); diagnostics != nil {
+			t.Fatalf("Expected no diagnostics for %v, got %v", events, diagnostics)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		state    core.State
+		expected core.DiagnosticKind
+	}{
+		{"unsupported version", core.State{Version: 99}, core.UnsupportedVersionDiagnostic},
+		{"invalid event", core.StateFromStrings([]string{"start"}), core.InvalidEventDiagnostic},
+		{"foreign root", core.StateFromStrings([]string{"start:release/prepare"}), core.ForeignRootDiagnostic},
+		{"unknown event", core.StateFromStrings([]string{"start:deploy/validate"}), core.UnknownEventDiagnostic},
+		{"duplicate event", core.StateFromStrings([]string{"start:deploy/prepare", "start:deploy/prepare"}), core.DuplicateEventDiagnostic},
+		{"mixed scopes", core.StateFromStrings([]string{"start:deploy/prepare", "completed:deploy"}), core.MixedScopesDiagnostic},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := sf.ValidateState(tt.state)
+			if len(diagnostics) != 1 || diagnostics[0].Kind != tt.expected {
+				t.Fatalf("Expected a single %s diagnostic, got %v", tt.expected, diagnostics)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"sync"
+)
+
+const (
+	// varsKey is the state data key holding the workflow variables.
+	varsKey = "vars"
+
+	// outputsKey is the state data key holding the step outputs.
+	outputsKey = "outputs"
+)
+
+// Variables is a key/value store scoped to a workflow instance. Values are JSON encoded and
+// persisted in the state data section on every Apply call.
+type Variables struct {
+	mu      sync.Mutex
+	dataKey string
+	values  map[string]json.RawMessage
+}
+
+// variablesContextKey is the context key used to make a store, identified by its state data key,
+// available to step functions.
+type variablesContextKey struct {
+	dataKey string
+}
+
+// Vars returns the variables of the workflow instance being applied. Outside of an Apply call,
+// it returns an empty store that is not persisted.
+func Vars(ctx context.Context) *Variables {
+	return variablesFromContext(ctx, varsKey)
+}
+
+// Outputs returns the step outputs of the workflow instance being applied, keyed by step name.
+// Outside of an Apply call, it returns an empty store that is not persisted.
+func Outputs(ctx context.Context) *Variables {
+	return variablesFromContext(ctx, outputsKey)
+}
+
+// variablesFromContext returns the store for the given state data key carried by ctx, or an empty store.
+func variablesFromContext(ctx context.Context, dataKey string) *Variables {
+	if vars, ok := ctx.Value(variablesContextKey{dataKey: dataKey}).(*Variables); ok {
+		return vars
+	}
+
+	return &Variables{dataKey: dataKey}
+}
+
+// withVariables returns a copy of ctx that carries the store decoded from the given state data key.
+func withVariables(ctx context.Context, state *State, dataKey string) (context.Context, *Variables, error) {
+	vars := &Variables{dataKey: dataKey}
+	if data, found := state.Data[dataKey]; found {
+		if err := json.Unmarshal(data, &vars.values); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return context.WithValue(ctx, variablesContextKey{dataKey: dataKey}, vars), vars, nil
+}
+
+// save stores the values in the state data.
+func (v *Variables) save(state *State) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(v.values) == 0 {
+		delete(state.Data, v.dataKey)
+		return nil
+	}
+
+	data, err := json.Marshal(v.values)
+	if err != nil {
+		return err
+	}
+
+	state.SetData(v.dataKey, data)
+	return nil
+}
+
+// Set JSON encodes value and stores it under the given name.
+func (v *Variables) Set(name string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.values == nil {
+		v.values = make(map[string]json.RawMessage)
+	}
+	v.values[name] = data
+	return nil
+}
+
+// Get decodes the value stored under the given name into target.
+// It returns false if there is no such value.
+func (v *Variables) Get(name string, target any) (bool, error) {
+	v.mu.Lock()
+	data, found := v.values[name]
+	v.mu.Unlock()
+
+	if !found {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(data, target)
+}
+
+// Delete removes the value stored under the given name.
+func (v *Variables) Delete(name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.values, name)
+}
+
+// Names returns the sorted names of the stored values.
+func (v *Variables) Names() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return slices.Sorted(maps.Keys(v.values))
+}
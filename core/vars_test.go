@@ -0,0 +1,69 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestVars_PersistedInState(t *testing.T) {
+	// Create a step flow that sets and deletes variables
+	item := core.NewStepsItem("steps", []core.StepFlowItem{
+		core.NewFuncItem("set", func(ctx context.Context) error {
+			if err := core.Vars(ctx).Set("count", 1); err != nil {
+				return err
+			}
+			return core.Vars(ctx).Set("temporary", true)
+		}),
+		core.NewFuncItem("update", func(ctx context.Context) error {
+			var count int
+			if _, err := core.Vars(ctx).Get("count", &count); err != nil {
+				return err
+			}
+			core.Vars(ctx).Delete("temporary")
+			return core.Vars(ctx).Set("count", count+1)
+		}),
+	})
+
+	sf, err := core.NewStepFlow(item)
+	if err != nil {
+		t.Fatalf("NewStepFlow returned an error: %v", err)
+	}
+
+	// The variables are stored in the state data after the first step
+	state, err := sf.ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	if string(state.Data["vars"]) != `{"count":1,"temporary":true}` {
+		t.Fatalf("Unexpected variables %s", state.Data["vars"])
+	}
+
+	// The variables are read back from the state by the second step
+	state, err = sf.ApplyState(context.Background(), state)
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	if string(state.Data["vars"]) != `{"count":2}` {
+		t.Fatalf("Unexpected variables %s", state.Data["vars"])
+	}
+}
+
+func TestVars_OutsideApply(t *testing.T) {
+	// Variables can be used outside of an Apply call without being persisted
+	vars := core.Vars(context.Background())
+	if err := vars.Set("name", "value"); err != nil {
+		t.Fatalf("Set returned an error: %v", err)
+	}
+
+	if names := vars.Names(); len(names) != 1 || names[0] != "name" {
+		t.Fatalf("Unexpected names %s", names)
+	}
+
+	if found, _ := core.Vars(context.Background()).Get("name", new(string)); found {
+		t.Fatal("Variables should not be shared outside of an Apply call")
+	}
+}
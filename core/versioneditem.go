@@ -0,0 +1,200 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// versionsKey is the state data key holding the versions chosen by the versioned items, keyed by scope.
+const versionsKey = "versions"
+
+// recordedVersion is the version chosen by a versioned item, as recorded in the state data.
+type recordedVersion struct {
+	// Version is the chosen version.
+	Version int `json:"version"`
+
+	// Fingerprint is the fingerprint of the chosen version, recorded at the end of the Apply call that chose it.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// versionedItem represents a workflow item that executes one of several versions of a group of steps.
+// The version is chosen the first time the item is entered and recorded in the state.
+type versionedItem struct {
+	scope    Scope
+	versions map[int]StepFlowItem
+}
+
+// NewVersionedItem creates a new workflow item that executes one of the given versions of a group of steps.
+// The first time a workflow instance enters the item, the latest version is chosen and recorded in the state,
+// so running instances keep their version when a new one is added. The versions are not covered by the fingerprint
+// of the workflow definition, so adding one does not invalidate the states of running instances, see WithFingerprint.
+// Instead, each version has its own fingerprint, recorded with the chosen version: Apply refuses states whose
+// recorded version was changed since it was chosen with ErrFingerprintMismatch.
+func NewVersionedItem(name string, versions map[int]StepFlowItem) StepFlowItem {
+	return &versionedItem{scope: NewScope(name), versions: versions}
+}
+
+// Transitions implements the StepFlowItem interface.
+// It connects the start of the item to the start of the chosen version, and the completion of each version
+// to the completion of the item.
+func (vi *versionedItem) Transitions(parent Scope) (Scope, []Transition, error) {
+	scope := WithParent(vi.scope, parent)
+	if len(vi.versions) == 0 {
+		return nil, nil, fmt.Errorf("versioned item %s must have at least one version", scope.Name())
+	}
+
+	var transitions []Transition
+	var possibleDestinations []PossibleDestination
+	versionScopes := make(map[int]Scope)
+	versionStarts := make(map[int]Event)
+	seenNames := make(map[string]bool)
+
+	for _, version := range slices.Sorted(maps.Keys(vi.versions)) {
+		// Get the version's scope and transitions.
+		versionScope, versionTransitions, err := vi.versions[version].Transitions(scope)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Ensure uniqueness of version names.
+		if seenNames[versionScope.Name()] {
+			return nil, nil, fmt.Errorf("name %s must be unique in the current context", versionScope.Name())
+		}
+		seenNames[versionScope.Name()] = true
+
+		versionScopes[version] = versionScope
+		versionStarts[version] = StartCommand(versionScope)
+		possibleDestinations = append(possibleDestinations, NewReason(StartCommand(versionScope), fmt.Sprintf("version %d", version)))
+
+		// When the version completes, complete the item. When it fails, re-raise the failure.
+		transitions = append(transitions, NewStaticTransition(CompletedEvent(versionScope), CompletedEvent(scope)))
+		transitions = append(transitions, reRaiseFailure(versionScope))
+		transitions = append(transitions, versionTransitions...)
+	}
+
+	latest := slices.Max(slices.Collect(maps.Keys(vi.versions)))
+
+	// When the item starts, start the recorded version, or record and start the latest one.
+	destinationFunc := func(ctx context.Context) ([]Event, error) {
+		versions := variablesFromContext(ctx, versionsKey)
+
+		recorded := recordedVersion{Version: latest}
+		found, err := versions.Get(scope.Name(), &recorded)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			if err := versions.Set(scope.Name(), recorded); err != nil {
+				return nil, err
+			}
+		}
+
+		start, defined := versionStarts[recorded.Version]
+		if !defined {
+			return nil, fmt.Errorf("recorded version %d of %s is not defined", recorded.Version, scope.Name())
+		}
+
+		return []Event{start}, nil
+	}
+
+	transitions = append(transitions, &versionedTransition{
+		Transition: NewDynamicTransition(StartCommand(scope), destinationFunc, possibleDestinations),
+		versions:   versionScopes,
+	})
+
+	return scope, transitions, nil
+}
+
+// versionedTransition is the transition starting the chosen version of a versioned item.
+// The versions are not covered by the fingerprint of the workflow definition, so that versions can be added
+// without invalidating the states of running instances.
+type versionedTransition struct {
+	Transition
+	versions map[int]Scope
+}
+
+// versionsOf returns the scopes of the versions started by the given transition, keyed by version, if any.
+func versionsOf(t Transition) map[int]Scope {
+	switch t := t.(type) {
+	case *versionedTransition:
+		return t.versions
+	case *retriableTransition:
+		return versionsOf(t.transition)
+	case *circuitBreakerTransition:
+		return versionsOf(t.transition)
+	case *errorRoutingTransition:
+		return versionsOf(t.transition)
+	}
+
+	return nil
+}
+
+// versionScopeNames returns the sorted names of the version scopes of all the versioned items of the given transitions.
+func versionScopeNames(transitionsMap map[string][]Transition) []string {
+	var names []string
+	for _, transitions := range transitionsMap {
+		for _, t := range transitions {
+			for _, scope := range versionsOf(t) {
+				names = append(names, scope.Name())
+			}
+		}
+	}
+
+	slices.Sort(names)
+	return names
+}
+
+// outermostVersionScope returns the name of the outermost version scope that is, or is a parent of, the given scope.
+func outermostVersionScope(versionScopes []string, scope string) (string, bool) {
+	var outermost string
+	for _, versionScope := range versionScopes {
+		if isSameOrParentScope(versionScope, scope) && (outermost == "" || len(versionScope) < len(outermost)) {
+			outermost = versionScope
+		}
+	}
+
+	return outermost, outermost != ""
+}
+
+// innermostVersionScope returns the name of the innermost version scope that is, or is a parent of, the given scope,
+// or an empty string if none.
+func innermostVersionScope(versionScopes []string, scope string) string {
+	var innermost string
+	for _, versionScope := range versionScopes {
+		if isSameOrParentScope(versionScope, scope) && len(versionScope) > len(innermost) {
+			innermost = versionScope
+		}
+	}
+
+	return innermost
+}
+
+// checkVersions returns an error if one of the versions recorded in the state data was changed since it was chosen,
+// and records the fingerprints of the versions chosen since the last check.
+func (sf *stepFlowImpl) checkVersions(versions *Variables) error {
+	for _, name := range versions.Names() {
+		var recorded recordedVersion
+		if _, err := versions.Get(name, &recorded); err != nil {
+			return err
+		}
+
+		// Undefined versions are reported when the versioned item starts them.
+		expected, found := sf.versions[name][recorded.Version]
+		switch {
+		case !found:
+			continue
+		case recorded.Fingerprint == "":
+			recorded.Fingerprint = expected
+			if err := versions.Set(name, recorded); err != nil {
+				return err
+			}
+		case recorded.Fingerprint != expected:
+			return fmt.Errorf("%w: version %d of %s: got %s, expected %s", ErrFingerprintMismatch, recorded.Version, name, recorded.Fingerprint, expected)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package core_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+func TestNewVersionedItem(t *testing.T) {
+	var calls []string
+	activity := func(name string) core.StepFlowItem {
+		return core.NewFuncItem(name, func(ctx context.Context) error {
+			calls = append(calls, name)
+			return nil
+		})
+	}
+
+	newFlow := func(versions map[int]core.StepFlowItem) core.StepFlow {
+		sf, err := core.NewStepFlow(core.NewStepsItem("deploy", []core.StepFlowItem{
+			core.NewVersionedItem("rolloutVersioned", versions),
+		}))
+		if err != nil {
+			t.Fatalf("Failed to create step flow: %v", err)
+		}
+
+		return sf
+	}
+
+	v1 := core.NewStepsItem("v1", []core.StepFlowItem{activity("rollout"), activity("notify")})
+	v2 := core.NewStepsItem("v2", []core.StepFlowItem{activity("canary"), activity("rollout")})
+
+	// A running instance enters the step while only v1 is defined
+	running, err := newFlow(map[int]core.StepFlowItem{1: v1}).ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	var versions map[string]struct {
+		Version     int    `json:"version"`
+		Fingerprint string `json:"fingerprint"`
+	}
+	if err := json.Unmarshal(running.Data["versions"], &versions); err != nil || versions["deploy/rolloutVersioned"].Version != 1 || versions["deploy/rolloutVersioned"].Fingerprint == "" {
+		t.Fatalf("Expected the recorded version, got %s", running.Data["versions"])
+	}
+
+	// Once v2 is added, the running instance keeps v1
+	sf := newFlow(map[int]core.StepFlowItem{1: v1, 2: v2})
+	calls = nil
+	for range 3 {
+		running, err = sf.ApplyState(context.Background(), running)
+		if err != nil {
+			t.Fatalf("ApplyState returned an error: %v", err)
+		}
+	}
+
+	if !sf.IsCompleted(running.Strings()) || !reflect.DeepEqual(calls, []string{"rollout", "notify"}) {
+		t.Fatalf("Expected the running instance to complete v1, got %v and calls %v", running.Events, calls)
+	}
+
+	// New instances get v2
+	calls = nil
+	var state core.State
+	for range 4 {
+		state, err = sf.ApplyState(context.Background(), state)
+		if err != nil {
+			t.Fatalf("ApplyState returned an error: %v", err)
+		}
+	}
+
+	if !sf.IsCompleted(state.Strings()) || !reflect.DeepEqual(calls, []string{"canary", "rollout"}) {
+		t.Fatalf("Expected the new instance to complete v2, got %v and calls %v", state.Events, calls)
+	}
+}
+
+func TestNewVersionedItem_ChangedVersion(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	newFlow := func(versions map[int]core.StepFlowItem) core.StepFlow {
+		sf, err := core.NewStepFlow(core.NewStepsItem("deploy", []core.StepFlowItem{
+			core.NewVersionedItem("rolloutVersioned", versions),
+		}))
+		if err != nil {
+			t.Fatalf("Failed to create step flow: %v", err)
+		}
+
+		return sf
+	}
+
+	v1 := core.NewStepsItem("v1", []core.StepFlowItem{core.NewFuncItem("rollout", noop), core.NewFuncItem("notify", noop)})
+	running, err := newFlow(map[int]core.StepFlowItem{1: v1}).ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	// Adding a version keeps the recorded version valid
+	v2 := core.NewStepsItem("v2", []core.StepFlowItem{core.NewFuncItem("canary", noop)})
+	if _, err := newFlow(map[int]core.StepFlowItem{1: v1, 2: v2}).ApplyState(context.Background(), running); err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	// Changing the recorded version is detected
+	changed := core.NewStepsItem("v1", []core.StepFlowItem{core.NewFuncItem("rollout", noop), core.NewFuncItem("verify", noop)})
+	_, err = newFlow(map[int]core.StepFlowItem{1: changed, 2: v2}).ApplyState(context.Background(), running)
+	if !errors.Is(err, core.ErrFingerprintMismatch) {
+		t.Fatalf("Expected ErrFingerprintMismatch, got %v", err)
+	}
+}
+
+func TestNewVersionedItem_NoVersions(t *testing.T) {
+	_, _, err := core.NewVersionedItem("emptyVersioned", nil).Transitions(nil)
+	if err == nil {
+		t.Fatal("Expected an error for an item without versions")
+	}
+}
+
+func TestNewVersionedItem_FingerprintAndCompactState(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	newFlow := func(name string, versions ...int) core.StepFlow {
+		items := make(map[int]core.StepFlowItem)
+		for _, version := range versions {
+			items[version] = core.NewStepsItem(fmt.Sprintf("v%d", version), []core.StepFlowItem{
+				core.NewFuncItem("rollout", noop),
+				core.NewFuncItem("notify", noop),
+			})
+		}
+
+		sf, err := core.NewStepFlow(core.NewStepsItem(name, []core.StepFlowItem{
+			core.NewVersionedItem("rolloutVersioned", items),
+			core.NewFuncItem("cleanup", noop),
+		}), core.WithFingerprint(true), core.WithCompactState(true))
+		if err != nil {
+			t.Fatalf("Failed to create step flow: %v", err)
+		}
+
+		return sf
+	}
+
+	v1 := newFlow("deploy", 1)
+	running, err := v1.ApplyState(context.Background(), core.State{})
+	if err != nil {
+		t.Fatalf("ApplyState returned an error: %v", err)
+	}
+
+	// Adding a version keeps the fingerprint, so the running instance can still be applied
+	sf := newFlow("deploy", 1, 2)
+	if sf.Fingerprint() != v1.Fingerprint() {
+		t.Fatalf("Expected fingerprint %s, got %s", v1.Fingerprint(), sf.Fingerprint())
+	}
+
+	expanded, err := sf.ExpandState(running)
+	if err != nil || !reflect.DeepEqual(expanded.Events, []string{"start:deploy/rolloutVersioned/v1"}) {
+		t.Fatalf("Expected the running instance within v1, got %v and %v", expanded.Events, err)
+	}
+
+	for range 4 {
+		if running, err = sf.ApplyState(context.Background(), running); err != nil {
+			t.Fatalf("ApplyState returned an error: %v", err)
+		}
+	}
+
+	if !sf.IsCompleted(running.Strings()) {
+		t.Fatalf("Expected a completed state, got %v", running.Events)
+	}
+
+	// Changes outside of the versions are still detected
+	if other := newFlow("release", 1, 2); other.Fingerprint() == sf.Fingerprint() {
+		t.Fatalf("Expected a different fingerprint, got %s", other.Fingerprint())
+	}
+}
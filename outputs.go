@@ -0,0 +1,41 @@
+package stepflow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+// DoResult adds a step that executes a function returning a result. The result is JSON encoded and
+// persisted in the state, so that later steps and conditions can read it with Output.
+// Results are keyed by step name, which must be unique among the DoResult steps of the workflow,
+// except across the versions of a Versioned step.
+func DoResult[T any](s *StepsSpec, name string, activityFunc func(ctx context.Context) (T, error), opts ...StepOption) *StepsSpec {
+	s.Do(name, func(ctx context.Context) error {
+		result, err := activityFunc(ctx)
+		if err != nil {
+			return err
+		}
+
+		return core.Outputs(ctx).Set(name, result)
+	}, opts...)
+	s.addOutputs(name)
+	return s
+}
+
+// Output returns the result of the step with the given name, added with DoResult.
+// It returns an error if the step has not produced a result yet.
+func Output[T any](ctx context.Context, stepName string) (T, error) {
+	var result T
+	found, err := core.Outputs(ctx).Get(stepName, &result)
+	if err != nil {
+		return result, err
+	}
+
+	if !found {
+		return result, fmt.Errorf("output of step %s not found", stepName)
+	}
+
+	return result, nil
+}
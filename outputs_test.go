@@ -0,0 +1,93 @@
+package stepflow_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cbalan/go-stepflow"
+)
+
+func TestDoResult(t *testing.T) {
+	type deployment struct {
+		ID       string `json:"id"`
+		Replicas int    `json:"replicas"`
+	}
+
+	createDeployment := func(ctx context.Context) (deployment, error) {
+		return deployment{ID: "d-42", Replicas: 3}, nil
+	}
+
+	hasReplicas := func(ctx context.Context) (bool, error) {
+		d, err := stepflow.Output[deployment](ctx, "createDeployment")
+		if err != nil {
+			return false, err
+		}
+
+		return d.Replicas > 0, nil
+	}
+
+	var scaled string
+	scale := func(ctx context.Context) error {
+		d, err := stepflow.Output[deployment](ctx, "createDeployment")
+		if err != nil {
+			return err
+		}
+
+		scaled = d.ID
+		return nil
+	}
+
+	flow, err := stepflow.New(stepflow.DoResult(stepflow.Named("TestDoResult"), "createDeployment", createDeployment).
+		Case("hasReplicas", hasReplicas, stepflow.Steps().
+			Do("scale", scale)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state []string
+	for i := range 4 {
+		state, err = flow.Apply(context.Background(), state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Logf("[%d] Stepflow new state: %s", i, state)
+	}
+
+	// stepflow should have been completed after the expected number of iterations.
+	if !flow.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	if scaled != "d-42" {
+		t.Fatalf("Expected scaled deployment d-42, got %s", scaled)
+	}
+}
+
+func TestOutput_NotFound(t *testing.T) {
+	_, err := stepflow.Output[string](context.Background(), "missing")
+	if err == nil {
+		t.Fatal("Expected an error for a missing output")
+	}
+}
+
+func TestDoResult_DuplicateNames(t *testing.T) {
+	fetch := func(ctx context.Context) (string, error) { return "ok", nil }
+
+	// Outputs of steps in different groups would overwrite each other
+	_, err := stepflow.New(stepflow.DoResult(stepflow.Named("TestDoResult_DuplicateNames"), "fetch", fetch).
+		Steps("nested", stepflow.DoResult(stepflow.Steps(), "fetch", fetch)))
+	if err == nil {
+		t.Fatal("Expected an error for duplicate output names")
+	}
+
+	// Only one version of a Versioned step runs, so its versions may produce the same outputs
+	_, err = stepflow.New(stepflow.Named("TestDoResult_DuplicateNames").
+		Versioned("fetch", map[int]*stepflow.StepsSpec{
+			1: stepflow.DoResult(stepflow.Steps(), "fetchData", fetch),
+			2: stepflow.DoResult(stepflow.Steps(), "fetchData", fetch),
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
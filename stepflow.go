@@ -2,14 +2,268 @@ package stepflow
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/cbalan/go-stepflow/core"
+	"maps"
+	"slices"
+	"time"
 )
 
 type StepFlow = core.StepFlow
 
+// State is the structured, versioned state of a workflow instance, as used by StepFlow.ApplyState.
+// It can be serialized with encoding/json or with MarshalBinary.
+type State = core.State
+
+// StateFromStrings converts a []string state, as used by StepFlow.Apply, to a State.
+func StateFromStrings(state []string) State {
+	return core.StateFromStrings(state)
+}
+
+// Variables is a key/value store scoped to a workflow instance, persisted in the state on every Apply call.
+type Variables = core.Variables
+
+// Vars returns the variables of the workflow instance being applied.
+// It is meant to be called from step functions, e.g. stepflow.Vars(ctx).Set("imageTag", imageTag).
+func Vars(ctx context.Context) *Variables {
+	return core.Vars(ctx)
+}
+
+// Event represents a specific point in the workflow execution, as stored in the state.
+type Event = core.Event
+
+// ParseEvent parses an event stored in the state, e.g. "start:deploy.v1/prepare".
+// The unescaped names of its scope are returned by ScopeNames.
+func ParseEvent(str string) (Event, error) {
+	return core.ParseEvent(str)
+}
+
+// Scope identifies the step of an event, e.g. "deploy.v1/prepare".
+type Scope = core.Scope
+
+// ScopeNames returns the unescaped names of the given scope and of its parents, outermost first.
+func ScopeNames(scope Scope) ([]string, error) {
+	return core.ScopeNames(scope)
+}
+
+// EscapeName escapes the reserved characters ':', '/' and '%' of a workflow name, see Named.
+func EscapeName(name string) string {
+	return core.EscapeName(name)
+}
+
+// Diagnostic describes a problem found by StepFlow.ValidateState, e.g. an event unknown to the workflow definition.
+type Diagnostic = core.Diagnostic
+
+// DiagnosticKind identifies the kind of problem found by StepFlow.ValidateState.
+type DiagnosticKind = core.DiagnosticKind
+
+// Kinds of problems found by StepFlow.ValidateState.
+const (
+	UnsupportedVersionDiagnostic  = core.UnsupportedVersionDiagnostic
+	FingerprintMismatchDiagnostic = core.FingerprintMismatchDiagnostic
+	InvalidSignatureDiagnostic    = core.InvalidSignatureDiagnostic
+	InvalidEventDiagnostic        = core.InvalidEventDiagnostic
+	ForeignRootDiagnostic         = core.ForeignRootDiagnostic
+	UnknownEventDiagnostic        = core.UnknownEventDiagnostic
+	DuplicateEventDiagnostic      = core.DuplicateEventDiagnostic
+	MixedScopesDiagnostic         = core.MixedScopesDiagnostic
+)
+
+// Migrator rewrites in-flight states of one workflow definition into states of another one, e.g. "deploy.v1" into "deploy.v2".
+type Migrator = core.Migrator
+
+// MigrationError is returned by Migrator.Migrate when some events of the state cannot be mapped.
+type MigrationError = core.MigrationError
+
+// NewMigrator creates a new migrator of the states of the from workflow into states of the to workflow.
+// Renamed, moved or removed steps are declared with Migrator.MapScope and Migrator.MapEvent,
+// and Migrator.Unmapped reports the events that still cannot be mapped.
+func NewMigrator(from StepFlow, to StepFlow) (*Migrator, error) {
+	return core.NewMigrator(from, to)
+}
+
+// StepError is returned by StepFlow.Apply when a step fails. It identifies the failing step
+// and wraps the original error, so it can be inspected with errors.As and errors.Is.
+type StepError = core.StepError
+
+// StepPanicError is returned by StepFlow.Apply when a step panics and panic recovery is enabled.
+// It holds the recovered value, the stack trace and the scope of the step.
+type StepPanicError = core.StepPanicError
+
+// CircuitBreaker is shared by workflow instances to stop calling steps that keep failing.
+// See StepsSpec.WithCircuitBreaker.
+type CircuitBreaker = core.CircuitBreaker
+
+// CircuitBreakerMetrics is a snapshot of a CircuitBreaker state and counters.
+type CircuitBreakerMetrics = core.CircuitBreakerMetrics
+
+// NewCircuitBreaker creates a circuit breaker that opens after failureThreshold consecutive failures
+// and allows a trial call once openDuration has passed.
+func NewCircuitBreaker(failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	return core.NewCircuitBreaker(failureThreshold, openDuration)
+}
+
+// Option configures the workflow created by New.
+type Option = core.Option
+
+// WithPanicRecovery enables or disables the recovery of panics raised by step functions.
+// Recovery is enabled by default. Disable it to let panics unwind through StepFlow.Apply.
+func WithPanicRecovery(enabled bool) Option {
+	return core.WithPanicRecovery(enabled)
+}
+
+// FailureError is returned by StepFlow.Apply when failure events are enabled and a step failure
+// reached the root of the workflow. The failure is also recorded in the state.
+type FailureError = core.FailureError
+
+// WithFailureEvents enables or disables failure events. When enabled, a failing step is recorded in the state
+// as a failed event that is re-raised to the enclosing steps until Retry or OnError handles it.
+// Unhandled failures move the workflow to a terminal failed state, for which Apply returns a *FailureError.
+func WithFailureEvents(enabled bool) Option {
+	return core.WithFailureEvents(enabled)
+}
+
+// WithAttempts enables or disables storing the consecutive failures of each failing step in the state,
+// so that StepError.Attempt keeps counting across Apply calls. It is disabled by default.
+func WithAttempts(enabled bool) Option {
+	return core.WithAttempts(enabled)
+}
+
+// ErrDeadlineExceeded is returned by StepFlow.Apply once a workflow instance has reached the terminal timed-out state.
+var ErrDeadlineExceeded = core.ErrDeadlineExceeded
+
+// WithDeadline sets an overall deadline for each workflow instance, measured from the moment it first
+// leaves the start state. The start time is stored in the state. Once the deadline has passed,
+// the instance runs the onDeadline steps, if not nil, and then moves to the terminal timed-out state,
+// for which Apply returns ErrDeadlineExceeded. The onDeadline steps are added as a group named "onDeadline",
+// so the workflow must not have a step of that name.
+func WithDeadline(deadline time.Duration, onDeadline *StepsSpec) Option {
+	if onDeadline == nil {
+		return core.WithDeadline(deadline, nil)
+	}
+
+	return core.WithDeadline(deadline, core.NewStepsItem("onDeadline", onDeadline.items))
+}
+
+// ErrFingerprintMismatch is returned by StepFlow.Apply for states produced by an incompatible workflow definition.
+var ErrFingerprintMismatch = core.ErrFingerprintMismatch
+
+// WithFingerprint enables or disables writing the fingerprint of the workflow definition, see StepFlow.Fingerprint,
+// into the state. Apply refuses states holding the fingerprint of another definition with ErrFingerprintMismatch,
+// e.g. a changed definition deployed by mistake under the same name.
+func WithFingerprint(enabled bool) Option {
+	return core.WithFingerprint(enabled)
+}
+
+// WithCompactState enables or disables the compact encoding of the states returned by Apply, in which
+// fully qualified scope names are replaced with short ids tied to the definition fingerprint.
+// Apply accepts both compact and readable states. See StepFlow.CompactState and StepFlow.ExpandState.
+func WithCompactState(enabled bool) Option {
+	return core.WithCompactState(enabled)
+}
+
+// HistoryEntry records a transition applied to a workflow instance: the source event, the destinations,
+// the reason of the destination taken, the time and the failure message, if any.
+type HistoryEntry = core.HistoryEntry
+
+// WithHistory enables an append-only history of the transitions applied to each workflow instance,
+// recorded in the state. Only the last maxEntries entries are kept.
+func WithHistory(maxEntries int) Option {
+	return core.WithHistory(maxEntries)
+}
+
+// HistoryFromState returns the execution history recorded in the given state, oldest entry first.
+// The history of encrypted states is read with StepFlow.History.
+func HistoryFromState(state State) ([]HistoryEntry, error) {
+	return core.HistoryFromState(state)
+}
+
+// DivergenceError is returned by Replay at the first history entry for which the workflow definition takes a different path.
+type DivergenceError = core.DivergenceError
+
+// Replay checks that the workflow definition takes the same path as the recorded history, see WithHistory,
+// without calling the step functions. It returns a *DivergenceError for the first entry for which the definition
+// takes a different path, e.g. to check that a refactored definition stays compatible with in-flight instances.
+func Replay(stepFlow StepFlow, history []HistoryEntry) error {
+	return core.Replay(stepFlow, history)
+}
+
+// ErrInvalidSignature is returned by StepFlow.Apply for states whose signature does not verify.
+var ErrInvalidSignature = core.ErrInvalidSignature
+
+// WithStateSigner signs the states returned by Apply with an HMAC-SHA256 of the given key. The signature
+// covers the definition fingerprint, so a state cannot be replayed against another workflow.
+// Apply refuses states whose signature does not verify, e.g. a forged "completed:" event, with ErrInvalidSignature.
+func WithStateSigner(key []byte) Option {
+	return core.WithStateSigner(key)
+}
+
+// Cipher encrypts the data section of the state at rest, see WithCipher.
+type Cipher = core.Cipher
+
+// NewAESGCMCipher creates a new AES-GCM cipher that encrypts with the given key and decrypts with the given key
+// or any of the old keys, to support key rotation. Keys must be 16, 24 or 32 bytes long.
+func NewAESGCMCipher(key []byte, oldKeys ...[]byte) (Cipher, error) {
+	return core.NewAESGCMCipher(key, oldKeys...)
+}
+
+// WithCipher encrypts the data section of the states returned by Apply, like variables, outputs, typed data
+// and failure messages. Events and metadata stay readable for debugging.
+func WithCipher(c Cipher) Option {
+	return core.WithCipher(c)
+}
+
+// ErrConflict is returned by CheckRevision when the stored state was changed by another Apply call.
+var ErrConflict = core.ErrConflict
+
+// WithRevision enables a revision number in the state, incremented by every Apply call, see State.Revision.
+func WithRevision(enabled bool) Option {
+	return core.WithRevision(enabled)
+}
+
+// CheckRevision returns ErrConflict unless the next state was applied from the stored state.
+// Stores call it, or perform the equivalent conditional write, before replacing the stored state,
+// so that two workers applying the same instance cannot both commit.
+func CheckRevision(stored State, next State) error {
+	return core.CheckRevision(stored, next)
+}
+
+// StateLimit identifies a limit on the state, see WithStateLimit.
+type StateLimit = core.StateLimit
+
+// LimitPolicy describes how Apply enforces an exceeded state limit.
+type LimitPolicy = core.LimitPolicy
+
+// StateLimitError is returned by StepFlow.Apply when a state limit with FailPolicy is exceeded.
+type StateLimitError = core.StateLimitError
+
+// State limits and policies, see WithStateLimit.
+const (
+	EventsLimit          = core.EventsLimit
+	VariablesBytesLimit  = core.VariablesBytesLimit
+	HistoryLimit         = core.HistoryLimit
+	FailPolicy           = core.FailPolicy
+	TruncateOldestPolicy = core.TruncateOldestPolicy
+	DropPolicy           = core.DropPolicy
+)
+
+// WithStateLimit sets a limit on the state returned by Apply, e.g. WithStateLimit(VariablesBytesLimit, 64<<10, FailPolicy).
+// FailPolicy makes Apply return a *StateLimitError, TruncateOldestPolicy removes the oldest entries
+// and DropPolicy drops the newest ones, or the variable changes made in the Apply call.
+// EventsLimit only supports FailPolicy, as active events are never removed, and HistoryLimit requires WithHistory.
+// With FailPolicy, Apply returns the new state along with the error, as its step functions have already been called.
+func WithStateLimit(limit StateLimit, max int, policy LimitPolicy) Option {
+	return core.WithStateLimit(limit, max, policy)
+}
+
 // New creates a new executable workflow from steps specification.
-func New(stepsSpec *StepsSpec) (StepFlow, error) {
-	return core.NewStepFlow(core.NewStepsItem(stepsSpec.name, stepsSpec.items))
+func New(stepsSpec *StepsSpec, opts ...Option) (StepFlow, error) {
+	if err := stepsSpec.err(); err != nil {
+		return nil, err
+	}
+
+	return core.NewStepFlow(core.NewStepsItem(stepsSpec.name, stepsSpec.items), opts...)
 }
 
 // NewStepFlow creates a new executable workflow from steps specification.
@@ -20,11 +274,17 @@ func NewStepFlow(stepsSpec *StepsSpec) (StepFlow, error) {
 
 // StepsSpec holds the structure of the step flow.
 type StepsSpec struct {
-	name  string
-	items []core.StepFlowItem
+	name    string
+	items   []core.StepFlowItem
+	outputs []string
+	errs    []error
 }
 
 // Named creates and returns a new StepsSpec with the given name for structuring step-based workflows.
+// Unlike step names, which must not contain the reserved characters ':', '/' and '%', the name may contain them.
+// It is stored as is, so events of names with reserved characters cannot be parsed unambiguously by ParseEvent,
+// unless the name is escaped with EscapeName. Escaping the name of an existing workflow changes its state format,
+// so the states of running instances must be migrated, see NewMigrator.
 func Named(name string) *StepsSpec {
 	return &StepsSpec{name: name}
 }
@@ -39,49 +299,149 @@ func Steps() *StepsSpec {
 // The steps in stepSpec are executed sequentially as a single logical unit.
 // This is useful for organizing complex workflows into logical components.
 func (s *StepsSpec) Steps(name string, stepsSpec *StepsSpec) *StepsSpec {
-	s.items = append(s.items, core.NewStepsItem(name, stepsSpec.items))
-	return s
+	return s.add(name, core.NewStepsItem(name, stepsSpec.items), stepsSpec)
 }
 
 // Do adds a step that executes a function when the workflow reaches this point.
 // This is the primary way to add business logic to a workflow.
-func (s *StepsSpec) Do(name string, activityFunc func(ctx context.Context) error) *StepsSpec {
-	s.items = append(s.items, core.NewFuncItem(name, activityFunc))
-	return s
+func (s *StepsSpec) Do(name string, activityFunc func(ctx context.Context) error, opts ...StepOption) *StepsSpec {
+	return s.add(name, core.NewFuncItem(name, newStepOptions(opts).activity(activityFunc)))
 }
 
 // WaitFor adds a step that pauses the workflow until a specified condition is met.
 // The condition function is evaluated repeatedly. The workflow only proceeds
 // when the function returns true.
-func (s *StepsSpec) WaitFor(name string, conditionFunc func(ctx context.Context) (bool, error)) *StepsSpec {
-	s.items = append(s.items, core.NewWaitForItem(name+"WaitFor", conditionFunc))
-	return s
+func (s *StepsSpec) WaitFor(name string, conditionFunc func(ctx context.Context) (bool, error), opts ...StepOption) *StepsSpec {
+	return s.add(name, core.NewWaitForItem(name+"WaitFor", newStepOptions(opts).condition(conditionFunc)))
 }
 
 // Retry adds retry logic to a group of steps.
 // If any step in the group fails with an error, the error handler function is called
 // to determine whether to retry the entire group of steps.
-func (s *StepsSpec) Retry(name string, errHandlerFunc func(ctx context.Context, err error) (bool, error), stepsSpec *StepsSpec) *StepsSpec {
-	s.items = append(s.items, core.NewRetryItem(core.NewStepsItem(name+"Retry", stepsSpec.items), errHandlerFunc))
-	return s
+func (s *StepsSpec) Retry(name string, errHandlerFunc func(ctx context.Context, err error) (bool, error), stepsSpec *StepsSpec, opts ...StepOption) *StepsSpec {
+	return s.add(name, core.NewRetryItem(core.NewStepsItem(name+"Retry", stepsSpec.items), newStepOptions(opts).errorHandler(errHandlerFunc)), stepsSpec)
 }
 
 // LoopUntil adds a step that repeats a group of steps until a condition is met.
 // After each execution of the steps, the condition function is evaluated.
 // If it returns true, the workflow proceeds to the next step. Otherwise, the steps are executed again.
-func (s *StepsSpec) LoopUntil(name string, conditionFunc func(ctx context.Context) (bool, error), stepsSpec *StepsSpec) *StepsSpec {
-	s.items = append(s.items, core.NewLoopUntilItem(name+"LoopUntil", core.NewStepsItem("steps", stepsSpec.items), conditionFunc))
-	return s
+func (s *StepsSpec) LoopUntil(name string, conditionFunc func(ctx context.Context) (bool, error), stepsSpec *StepsSpec, opts ...StepOption) *StepsSpec {
+	return s.add(name, core.NewLoopUntilItem(name+"LoopUntil", core.NewStepsItem("steps", stepsSpec.items), newStepOptions(opts).condition(conditionFunc)), stepsSpec)
+}
+
+// WithCircuitBreaker adds a group of steps guarded by a circuit breaker.
+// The breaker is meant to be shared by all the workflow instances that call the same downstream system.
+// Failures of the steps are recorded in the breaker, and while it is open the steps are deferred:
+// Apply leaves the state unchanged instead of calling them. Wrap it in Retry to retry its failures.
+func (s *StepsSpec) WithCircuitBreaker(name string, breaker *CircuitBreaker, stepsSpec *StepsSpec) *StepsSpec {
+	return s.add(name, core.NewCircuitBreakerItem(core.NewStepsItem(name+"CircuitBreaker", stepsSpec.items), breaker), stepsSpec)
+}
+
+// OnError adds a group of steps whose errors are routed to named recovery branches.
+// When a step of the group fails, the classifier function names the branch to execute, e.g. "quota" or "auth".
+// Once the branch completes, the group is resumed from its start, or continued after, see Resume and ContinueAfter.
+// Errors for which the classifier returns a name without a matching branch are returned by Apply.
+func (s *StepsSpec) OnError(name string, classifierFunc func(err error) string, handlers map[string]Recovery, stepsSpec *StepsSpec) *StepsSpec {
+	branches := make(map[string]core.RecoveryBranch)
+	nested := []*StepsSpec{stepsSpec}
+	for branchName, handler := range handlers {
+		if err := core.ValidateName(branchName); err != nil {
+			s.errs = append(s.errs, err)
+		}
+
+		branches[branchName] = core.RecoveryBranch{Item: core.NewStepsItem(branchName, handler.stepsSpec.items), ContinueAfter: handler.continueAfter}
+		nested = append(nested, handler.stepsSpec)
+	}
+
+	return s.add(name, core.NewOnErrorItem(name+"OnError", core.NewStepsItem("steps", stepsSpec.items), classifierFunc, branches), nested...)
+}
+
+// Recovery is a recovery branch of OnError, created with Resume or ContinueAfter.
+type Recovery struct {
+	stepsSpec     *StepsSpec
+	continueAfter bool
+}
+
+// Resume returns a recovery branch that executes the given steps, then resumes the failed group of steps from its start.
+func Resume(stepsSpec *StepsSpec) Recovery {
+	return Recovery{stepsSpec: stepsSpec}
+}
+
+// ContinueAfter returns a recovery branch that executes the given steps, then continues after the failed group of steps.
+func ContinueAfter(stepsSpec *StepsSpec) Recovery {
+	return Recovery{stepsSpec: stepsSpec, continueAfter: true}
+}
+
+// ContinueAsNew adds a step that starts the workflow again from its first step, as a new run.
+// The new run keeps the variables named in keepVars and the typed workflow data, while the history, the step outputs,
+// the other variables, the versions chosen by Versioned steps and the deadline are reset. This bounds the state of workflows that loop forever.
+func (s *StepsSpec) ContinueAsNew(name string, keepVars ...string) *StepsSpec {
+	return s.add(name, core.NewContinueAsNewItem(name+"ContinueAsNew", keepVars...))
+}
+
+// Versioned adds a step that executes one of several versions of a group of steps.
+// The first time a workflow instance enters the step, the latest version is chosen and recorded in the state:
+// running instances keep their version while new instances get the latest one.
+// This allows small changes of a definition without migrating the states of running instances.
+func (s *StepsSpec) Versioned(name string, versions map[int]*StepsSpec) *StepsSpec {
+	items := make(map[int]core.StepFlowItem)
+	merged := &StepsSpec{}
+	for _, version := range slices.Sorted(maps.Keys(versions)) {
+		items[version] = core.NewStepsItem(fmt.Sprintf("v%d", version), versions[version].items)
+
+		// Only one version runs, so the versions may produce the same outputs.
+		merged.errs = append(merged.errs, versions[version].errs...)
+		for _, output := range versions[version].outputs {
+			if !slices.Contains(merged.outputs, output) {
+				merged.outputs = append(merged.outputs, output)
+			}
+		}
+	}
+
+	return s.add(name, core.NewVersionedItem(name+"Versioned", items), merged)
 }
 
 // Case adds a step that conditionally executes a group of steps based on a condition.
 // The child steps are executed only if the condition function returns true.
 // If the condition function returns false, the case step is skipped and the workflow proceeds to the next step.
-func (s *StepsSpec) Case(name string, conditionFunc func(ctx context.Context) (bool, error), stepsSpec *StepsSpec) *StepsSpec {
-	s.items = append(s.items, core.NewCaseItem(name+"Case", core.NewStepsItem("steps", stepsSpec.items), conditionFunc))
+func (s *StepsSpec) Case(name string, conditionFunc func(ctx context.Context) (bool, error), stepsSpec *StepsSpec, opts ...StepOption) *StepsSpec {
+	return s.add(name, core.NewCaseItem(name+"Case", core.NewStepsItem("steps", stepsSpec.items), newStepOptions(opts).condition(conditionFunc)), stepsSpec)
+}
+
+// add appends an item to the steps specification. Invalid step names, duplicate output names and the errors
+// of the nested steps specifications are recorded and returned when the workflow is created.
+func (s *StepsSpec) add(name string, item core.StepFlowItem, nested ...*StepsSpec) *StepsSpec {
+	if err := core.ValidateName(name); err != nil {
+		s.errs = append(s.errs, err)
+	}
+
+	for _, stepsSpec := range nested {
+		s.errs = append(s.errs, stepsSpec.errs...)
+		s.addOutputs(stepsSpec.outputs...)
+	}
+
+	s.items = append(s.items, item)
 	return s
 }
 
+// addOutputs records the names of the outputs produced by the steps, see DoResult.
+// Outputs are keyed by step name, so duplicate names are recorded as errors.
+func (s *StepsSpec) addOutputs(names ...string) {
+	for _, name := range names {
+		if slices.Contains(s.outputs, name) {
+			s.errs = append(s.errs, fmt.Errorf("output name %s must be unique in the workflow", name))
+			continue
+		}
+
+		s.outputs = append(s.outputs, name)
+	}
+}
+
+// err returns the errors recorded while building the steps specification, if any.
+func (s *StepsSpec) err() error {
+	return errors.Join(s.errs...)
+}
+
 // WithName sets the steps specification name. Information mainly used for the top level steps.
 // Deprecated: Please use Named(name)
 func (s *StepsSpec) WithName(name string) *StepsSpec {
@@ -92,5 +452,9 @@ func (s *StepsSpec) WithName(name string) *StepsSpec {
 // Transitions returns the list of transitions as defined by the steps specification.
 // This helper function enables consumers to inspect the underlying workflow state machine.
 func Transitions(stepsSpec *StepsSpec) (core.Scope, []core.Transition, error) {
+	if err := stepsSpec.err(); err != nil {
+		return nil, nil, err
+	}
+
 	return core.NewStepsItem(stepsSpec.name, stepsSpec.items).Transitions(nil)
 }
@@ -2,9 +2,13 @@ package stepflow_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/cbalan/go-stepflow"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSteps(t *testing.T) {
@@ -438,3 +442,342 @@ func TestGenericExample(t *testing.T) {
 	}
 
 }
+
+func TestWithTimeout(t *testing.T) {
+	waitForCancellation := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	attempts := 0
+	retryTimeouts := func(ctx context.Context, err error) (bool, error) {
+		var timeoutErr *stepflow.StepTimeoutError
+		attempts++
+		return errors.As(err, &timeoutErr) && attempts < 3, nil
+	}
+
+	flow, err := stepflow.New(stepflow.Named("TestWithTimeout").
+		Retry("slow", retryTimeouts, stepflow.Steps().
+			Do("waitForCancellation", waitForCancellation, stepflow.WithTimeout(10*time.Millisecond))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state []string
+	for i := range 3 {
+		state, err = flow.Apply(context.Background(), state)
+		if err != nil {
+			break
+		}
+
+		t.Logf("[%d] Stepflow new state: %s", i, state)
+	}
+
+	// The last timeout is not retried and is returned to the caller.
+	var stepErr *stepflow.StepError
+	if !errors.As(err, &stepErr) {
+		t.Fatalf("Expected *stepflow.StepError, got %v", err)
+	}
+
+	var timeoutErr *stepflow.StepTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Expected *stepflow.StepTimeoutError, got %v", err)
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestOnError(t *testing.T) {
+	errAuth := errors.New("credentials expired")
+
+	var ex []string
+	doLog := func(message string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			ex = append(ex, message)
+			return nil
+		}
+	}
+
+	deploy := func(ctx context.Context) error {
+		ex = append(ex, "deploy")
+		if len(ex) == 1 {
+			return errAuth
+		}
+		return nil
+	}
+
+	classify := func(err error) string {
+		if errors.Is(err, errAuth) {
+			return "auth"
+		}
+		return ""
+	}
+
+	flow, err := stepflow.New(stepflow.Named("TestOnError").
+		OnError("deploy", classify, map[string]stepflow.Recovery{
+			"auth": stepflow.Resume(stepflow.Steps().Do("refreshCredentials", doLog("refreshCredentials"))),
+		}, stepflow.Steps().
+			Do("deploy", deploy)).
+		Do("cleanup", doLog("cleanup")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state []string
+	for i := range 5 {
+		state, err = flow.Apply(context.Background(), state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Logf("[%d] Stepflow new state: %s", i, state)
+	}
+
+	// stepflow should have been completed after the expected number of iterations.
+	if !flow.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	expectedExString := "[deploy refreshCredentials deploy cleanup]"
+	if fmt.Sprintf("%s", ex) != expectedExString {
+		t.Fatalf("Unexpected exchange. Expected: %s, Actual: %s", expectedExString, ex)
+	}
+}
+
+func TestOnError_ContinueAfter(t *testing.T) {
+	errQuota := errors.New("quota exceeded")
+
+	var ex []string
+	doLog := func(message string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			ex = append(ex, message)
+			return nil
+		}
+	}
+
+	flow, err := stepflow.New(stepflow.Named("TestOnErrorContinueAfter").
+		OnError("deploy", func(err error) string { return "quota" }, map[string]stepflow.Recovery{
+			"quota": stepflow.ContinueAfter(stepflow.Steps().Do("notify", doLog("notify"))),
+		}, stepflow.Steps().
+			Do("deploy", func(ctx context.Context) error { ex = append(ex, "deploy"); return errQuota }).
+			Do("verify", doLog("verify"))).
+		Do("cleanup", doLog("cleanup")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state []string
+	for range 5 {
+		state, err = flow.Apply(context.Background(), state)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !flow.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	// The deploy steps are not resumed once the recovery branch completes
+	expectedExString := "[deploy notify cleanup]"
+	if fmt.Sprintf("%s", ex) != expectedExString {
+		t.Fatalf("Unexpected exchange. Expected: %s, Actual: %s", expectedExString, ex)
+	}
+}
+
+func TestFailureEvents(t *testing.T) {
+	errDown := errors.New("downstream is down")
+	failing := func(ctx context.Context) error {
+		return errDown
+	}
+
+	flow, err := stepflow.New(stepflow.Named("TestFailureEvents").
+		Steps("deploy", stepflow.Steps().
+			Do("failing", failing)),
+		stepflow.WithFailureEvents(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := flow.Apply(context.Background(), nil)
+	var failureErr *stepflow.FailureError
+	if !errors.As(err, &failureErr) || !errors.Is(err, errDown) {
+		t.Fatalf("Expected *stepflow.FailureError wrapping %v, got %v", errDown, err)
+	}
+
+	if state[0] != "failed:TestFailureEvents" {
+		t.Fatalf("Unexpected state %s", state)
+	}
+}
+
+func TestVars(t *testing.T) {
+	prepare := func(ctx context.Context) error {
+		return stepflow.Vars(ctx).Set("deploymentId", "d-42")
+	}
+
+	var deployed string
+	deploy := func(ctx context.Context) error {
+		found, err := stepflow.Vars(ctx).Get("deploymentId", &deployed)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return fmt.Errorf("deploymentId not found")
+		}
+
+		return nil
+	}
+
+	flow, err := stepflow.New(stepflow.Named("TestVars").
+		Do("prepare", prepare).
+		Do("deploy", deploy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state []string
+	for i := range 3 {
+		state, err = flow.Apply(context.Background(), state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Logf("[%d] Stepflow new state: %s", i, state)
+	}
+
+	// stepflow should have been completed after the expected number of iterations.
+	if !flow.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	if deployed != "d-42" {
+		t.Fatalf("Expected deploymentId d-42, got %s", deployed)
+	}
+}
+
+func TestReservedNames(t *testing.T) {
+	noop := func(ctx context.Context) error {
+		return nil
+	}
+
+	// Step names with reserved characters are rejected, including in nested steps
+	_, err := stepflow.New(stepflow.Named("TestReservedNames").
+		Steps("nested", stepflow.Steps().
+			Do("db:migrate", noop)))
+	if err == nil {
+		t.Fatal("Expected an error for a step name with reserved characters")
+	}
+
+	// The workflow name is escaped on demand
+	flow, err := stepflow.New(stepflow.Named(stepflow.EscapeName("deploy/v1")).
+		Do("migrate", noop))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := flow.Apply(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := stepflow.ParseEvent(state[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Scope().Name() != "deploy%2Fv1/migrate" || event.Scope().Parent().Name() != "deploy%2Fv1" {
+		t.Fatalf("Unexpected event %s", state[0])
+	}
+
+	names, err := stepflow.ScopeNames(event.Scope())
+	if err != nil || !slices.Equal(names, []string{"deploy/v1", "migrate"}) {
+		t.Fatalf("Unexpected scope names %v, %v", names, err)
+	}
+
+	// Otherwise, the workflow name is stored as is
+	flow, err = stepflow.New(stepflow.Named("deploy/v1").
+		Do("migrate", noop))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state, err = flow.Apply(context.Background(), nil); err != nil || state[0] != "completed:deploy/v1/migrate" {
+		t.Fatalf("Unexpected state %s, %v", state, err)
+	}
+}
+
+func TestContinueAsNew(t *testing.T) {
+	reconcile := func(ctx context.Context) error {
+		var runs int
+		if _, err := stepflow.Vars(ctx).Get("runs", &runs); err != nil {
+			return err
+		}
+		return stepflow.Vars(ctx).Set("runs", runs+1)
+	}
+
+	flow, err := stepflow.New(stepflow.Named("TestContinueAsNew").
+		Do("reconcile", reconcile).
+		ContinueAsNew("restart", "runs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state []string
+	for i := range 6 {
+		state, err = flow.Apply(context.Background(), state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Logf("[%d] Stepflow new state: %s", i, state)
+	}
+
+	// The workflow never completes, and the kept variable counts the runs
+	if flow.IsCompleted(state) || !slices.Equal(state, []string{"start:TestContinueAsNew", `$vars={"runs":3}`}) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+}
+
+func TestVersioned(t *testing.T) {
+	noop := func(ctx context.Context) error {
+		return nil
+	}
+
+	flow, err := stepflow.New(stepflow.Named("TestVersioned").
+		Versioned("rollout", map[int]*stepflow.StepsSpec{
+			1: stepflow.Steps().Do("deploy", noop),
+			2: stepflow.Steps().Do("canary", noop).Do("deploy", noop),
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state []string
+	for i := range 4 {
+		state, err = flow.Apply(context.Background(), state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Logf("[%d] Stepflow new state: %s", i, state)
+	}
+
+	// New instances run the latest version, which is recorded in the state
+	if !flow.IsCompleted(state) || !strings.HasPrefix(state[1], `$versions={"TestVersioned/rolloutVersioned":{"version":2,"fingerprint":`) {
+		t.Fatalf("Unexpected state %s", state)
+	}
+
+	// Invalid step names of the versions are reported
+	_, err = stepflow.New(stepflow.Named("TestVersioned").
+		Versioned("rollout", map[int]*stepflow.StepsSpec{1: stepflow.Steps().Do("db:migrate", noop)}))
+	if err == nil {
+		t.Fatal("Expected an error for a step name with reserved characters")
+	}
+}
@@ -0,0 +1,87 @@
+package stepflow
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+// StepTimeoutError is returned by StepFlow.Apply, wrapped in a StepError, when a step function
+// does not complete within the timeout configured with WithTimeout.
+type StepTimeoutError = core.StepTimeoutError
+
+// StepOption configures a single step of a StepsSpec.
+type StepOption func(*stepOptions)
+
+// stepOptions holds the configuration of a single step.
+type stepOptions struct {
+	timeout time.Duration
+}
+
+// newStepOptions returns the step configuration obtained by applying the given options.
+func newStepOptions(opts []StepOption) stepOptions {
+	var o stepOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithTimeout sets a deadline for each call of the step function.
+// The context handed to the function is cancelled after the timeout. If the function then fails,
+// its error is wrapped in a *StepTimeoutError that Retry error handlers can classify.
+func WithTimeout(timeout time.Duration) StepOption {
+	return func(o *stepOptions) {
+		o.timeout = timeout
+	}
+}
+
+// activity applies the step configuration to an activity function.
+func (o stepOptions) activity(activityFunc func(ctx context.Context) error) func(ctx context.Context) error {
+	fn := withTimeout(o.timeout, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, activityFunc(ctx)
+	})
+
+	return func(ctx context.Context) error {
+		_, err := fn(ctx)
+		return err
+	}
+}
+
+// condition applies the step configuration to a condition function.
+func (o stepOptions) condition(conditionFunc func(ctx context.Context) (bool, error)) func(ctx context.Context) (bool, error) {
+	return withTimeout(o.timeout, conditionFunc)
+}
+
+// errorHandler applies the step configuration to an error handler function.
+func (o stepOptions) errorHandler(errHandlerFunc func(ctx context.Context, err error) (bool, error)) func(ctx context.Context, err error) (bool, error) {
+	return func(ctx context.Context, err error) (bool, error) {
+		return withTimeout(o.timeout, func(ctx context.Context) (bool, error) {
+			return errHandlerFunc(ctx, err)
+		})(ctx)
+	}
+}
+
+// withTimeout wraps fn so that each call runs with its own deadline.
+// Errors returned after the step deadline has passed are wrapped in a *StepTimeoutError,
+// unless the parent context was done as well.
+func withTimeout[T any](timeout time.Duration, fn func(ctx context.Context) (T, error)) func(ctx context.Context) (T, error) {
+	if timeout <= 0 {
+		return fn
+	}
+
+	return func(ctx context.Context) (T, error) {
+		stepCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		result, err := fn(stepCtx)
+		if err != nil && ctx.Err() == nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+			return result, &StepTimeoutError{Timeout: timeout, Err: err}
+		}
+
+		return result, err
+	}
+}
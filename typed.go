@@ -0,0 +1,264 @@
+package stepflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cbalan/go-stepflow/core"
+)
+
+// typedDataKey is the state data key holding the typed workflow data.
+const typedDataKey = "data"
+
+// errTypedDataNotFound is returned by typed step functions applied without ApplyTyped.
+var errTypedDataNotFound = errors.New("typed workflow data not found, use ApplyTyped")
+
+// typedDataContextKey is the context key used to make the typed workflow data available to step functions.
+type typedDataContextKey struct{}
+
+// typedData returns the typed workflow data carried by ctx.
+func typedData[T any](ctx context.Context) (*T, error) {
+	data, ok := ctx.Value(typedDataContextKey{}).(*T)
+	if !ok {
+		return nil, errTypedDataNotFound
+	}
+
+	return data, nil
+}
+
+// TypedStepsSpec holds the structure of a step flow whose step functions receive the workflow data as *T.
+type TypedStepsSpec[T any] struct {
+	spec *StepsSpec
+}
+
+// TypedNamed creates and returns a new TypedStepsSpec with the given name.
+func TypedNamed[T any](name string) *TypedStepsSpec[T] {
+	return &TypedStepsSpec[T]{spec: Named(name)}
+}
+
+// TypedSteps creates a new empty typed steps specification.
+func TypedSteps[T any]() *TypedStepsSpec[T] {
+	return &TypedStepsSpec[T]{spec: Steps()}
+}
+
+// Steps adds a nested group of steps to the workflow with the given name. See StepsSpec.Steps.
+func (s *TypedStepsSpec[T]) Steps(name string, stepsSpec *TypedStepsSpec[T]) *TypedStepsSpec[T] {
+	s.spec.Steps(name, stepsSpec.spec)
+	return s
+}
+
+// Do adds a step that executes a function with the workflow data. See StepsSpec.Do.
+func (s *TypedStepsSpec[T]) Do(name string, activityFunc func(ctx context.Context, data *T) error, opts ...StepOption) *TypedStepsSpec[T] {
+	s.spec.Do(name, func(ctx context.Context) error {
+		data, err := typedData[T](ctx)
+		if err != nil {
+			return err
+		}
+
+		return activityFunc(ctx, data)
+	}, opts...)
+	return s
+}
+
+// TypedDoResult adds a step that executes a function with the workflow data and returns a result,
+// which later steps read with Output. See DoResult.
+func TypedDoResult[T any, R any](s *TypedStepsSpec[T], name string, activityFunc func(ctx context.Context, data *T) (R, error), opts ...StepOption) *TypedStepsSpec[T] {
+	DoResult(s.spec, name, func(ctx context.Context) (R, error) {
+		data, err := typedData[T](ctx)
+		if err != nil {
+			var result R
+			return result, err
+		}
+
+		return activityFunc(ctx, data)
+	}, opts...)
+	return s
+}
+
+// WaitFor adds a step that pauses the workflow until a condition on the workflow data is met. See StepsSpec.WaitFor.
+func (s *TypedStepsSpec[T]) WaitFor(name string, conditionFunc func(ctx context.Context, data *T) (bool, error), opts ...StepOption) *TypedStepsSpec[T] {
+	s.spec.WaitFor(name, typedCondition(conditionFunc), opts...)
+	return s
+}
+
+// Retry adds retry logic to a group of steps. See StepsSpec.Retry.
+func (s *TypedStepsSpec[T]) Retry(name string, errHandlerFunc func(ctx context.Context, data *T, err error) (bool, error), stepsSpec *TypedStepsSpec[T], opts ...StepOption) *TypedStepsSpec[T] {
+	s.spec.Retry(name, func(ctx context.Context, err error) (bool, error) {
+		data, dataErr := typedData[T](ctx)
+		if dataErr != nil {
+			return false, dataErr
+		}
+
+		return errHandlerFunc(ctx, data, err)
+	}, stepsSpec.spec, opts...)
+	return s
+}
+
+// LoopUntil adds a step that repeats a group of steps until a condition on the workflow data is met.
+// See StepsSpec.LoopUntil.
+func (s *TypedStepsSpec[T]) LoopUntil(name string, conditionFunc func(ctx context.Context, data *T) (bool, error), stepsSpec *TypedStepsSpec[T], opts ...StepOption) *TypedStepsSpec[T] {
+	s.spec.LoopUntil(name, typedCondition(conditionFunc), stepsSpec.spec, opts...)
+	return s
+}
+
+// WithCircuitBreaker adds a group of steps guarded by a circuit breaker. See StepsSpec.WithCircuitBreaker.
+func (s *TypedStepsSpec[T]) WithCircuitBreaker(name string, breaker *CircuitBreaker, stepsSpec *TypedStepsSpec[T]) *TypedStepsSpec[T] {
+	s.spec.WithCircuitBreaker(name, breaker, stepsSpec.spec)
+	return s
+}
+
+// OnError adds a group of steps whose errors are routed to named recovery branches, created with TypedResume
+// or TypedContinueAfter. See StepsSpec.OnError.
+func (s *TypedStepsSpec[T]) OnError(name string, classifierFunc func(err error) string, handlers map[string]Recovery, stepsSpec *TypedStepsSpec[T]) *TypedStepsSpec[T] {
+	s.spec.OnError(name, classifierFunc, handlers, stepsSpec.spec)
+	return s
+}
+
+// TypedResume returns a recovery branch that executes the given steps, then resumes the failed group of steps. See Resume.
+func TypedResume[T any](stepsSpec *TypedStepsSpec[T]) Recovery {
+	return Resume(stepsSpec.spec)
+}
+
+// TypedContinueAfter returns a recovery branch that executes the given steps, then continues after the failed group
+// of steps. See ContinueAfter.
+func TypedContinueAfter[T any](stepsSpec *TypedStepsSpec[T]) Recovery {
+	return ContinueAfter(stepsSpec.spec)
+}
+
+// ContinueAsNew adds a step that starts the workflow again from its first step, as a new run. See StepsSpec.ContinueAsNew.
+func (s *TypedStepsSpec[T]) ContinueAsNew(name string, keepVars ...string) *TypedStepsSpec[T] {
+	s.spec.ContinueAsNew(name, keepVars...)
+	return s
+}
+
+// Versioned adds a step that executes one of several versions of a group of steps. See StepsSpec.Versioned.
+func (s *TypedStepsSpec[T]) Versioned(name string, versions map[int]*TypedStepsSpec[T]) *TypedStepsSpec[T] {
+	specs := make(map[int]*StepsSpec)
+	for version, stepsSpec := range versions {
+		specs[version] = stepsSpec.spec
+	}
+
+	s.spec.Versioned(name, specs)
+	return s
+}
+
+// Case adds a step that executes a group of steps if a condition on the workflow data is met. See StepsSpec.Case.
+func (s *TypedStepsSpec[T]) Case(name string, conditionFunc func(ctx context.Context, data *T) (bool, error), stepsSpec *TypedStepsSpec[T], opts ...StepOption) *TypedStepsSpec[T] {
+	s.spec.Case(name, typedCondition(conditionFunc), stepsSpec.spec, opts...)
+	return s
+}
+
+// typedCondition adapts a typed condition function to a condition function.
+func typedCondition[T any](conditionFunc func(ctx context.Context, data *T) (bool, error)) func(ctx context.Context) (bool, error) {
+	return func(ctx context.Context) (bool, error) {
+		data, err := typedData[T](ctx)
+		if err != nil {
+			return false, err
+		}
+
+		return conditionFunc(ctx, data)
+	}
+}
+
+// TypedWithDeadline sets an overall deadline for each typed workflow instance, whose onDeadline steps, if not nil,
+// receive the workflow data. See WithDeadline.
+func TypedWithDeadline[T any](deadline time.Duration, onDeadline *TypedStepsSpec[T]) Option {
+	if onDeadline == nil {
+		return WithDeadline(deadline, nil)
+	}
+
+	return WithDeadline(deadline, onDeadline.spec)
+}
+
+// TypedStepFlow is an executable workflow whose step functions receive the workflow data as *T.
+type TypedStepFlow[T any] struct {
+	flow StepFlow
+}
+
+// NewTyped creates a new executable typed workflow from a typed steps specification.
+func NewTyped[T any](stepsSpec *TypedStepsSpec[T], opts ...Option) (*TypedStepFlow[T], error) {
+	flow, err := New(stepsSpec.spec, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedStepFlow[T]{flow: flow}, nil
+}
+
+// ApplyTyped executes the workflow from the given state. The workflow data is read from the state into data,
+// unless the state does not hold any yet, in which case data is used as the initial value.
+// Once applied, data is serialized back into the returned state, alongside the events.
+func (f *TypedStepFlow[T]) ApplyTyped(ctx context.Context, state State, data *T) (State, error) {
+	ctx = core.WithStateData(ctx, typedDataKey, typedStateData[T]{data: data})
+	return f.flow.ApplyState(context.WithValue(ctx, typedDataContextKey{}, data), state)
+}
+
+// typedStateData binds the typed workflow data to the state data, see core.WithStateData.
+type typedStateData[T any] struct {
+	data *T
+}
+
+// Load implements the core.StateData interface.
+// The data is reset before it is decoded, so the stored data is not merged with the initial value.
+func (d typedStateData[T]) Load(data json.RawMessage) error {
+	var zero T
+	*d.data = zero
+	return json.Unmarshal(data, d.data)
+}
+
+// Save implements the core.StateData interface.
+func (d typedStateData[T]) Save() (json.RawMessage, error) {
+	return json.Marshal(d.data)
+}
+
+// IsCompleted checks if the workflow has reached its completion state.
+func (f *TypedStepFlow[T]) IsCompleted(state State) bool {
+	return f.flow.IsCompleted(state.Strings())
+}
+
+// ValidateState checks the given state against the workflow definition without applying it. See StepFlow.ValidateState.
+func (f *TypedStepFlow[T]) ValidateState(state State) []Diagnostic {
+	return f.flow.ValidateState(state)
+}
+
+// Fingerprint returns a stable fingerprint of the workflow definition. See StepFlow.Fingerprint.
+func (f *TypedStepFlow[T]) Fingerprint() string {
+	return f.flow.Fingerprint()
+}
+
+// CompactState converts the given state to its compact form. See StepFlow.CompactState.
+func (f *TypedStepFlow[T]) CompactState(state State) (State, error) {
+	return f.flow.CompactState(state)
+}
+
+// ExpandState converts a state returned by CompactState back to its readable form. See StepFlow.ExpandState.
+func (f *TypedStepFlow[T]) ExpandState(state State) (State, error) {
+	return f.flow.ExpandState(state)
+}
+
+// History returns the execution history recorded in the given state. See StepFlow.History.
+func (f *TypedStepFlow[T]) History(state State) ([]HistoryEntry, error) {
+	return f.flow.History(state)
+}
+
+// MoveTo returns a copy of the state in which the step of the given scope starts. See StepFlow.MoveTo.
+func (f *TypedStepFlow[T]) MoveTo(state State, scope string) (State, error) {
+	return f.flow.MoveTo(state, scope)
+}
+
+// Skip returns a copy of the state in which the step of the given scope is completed without running it. See StepFlow.Skip.
+func (f *TypedStepFlow[T]) Skip(state State, scope string) (State, error) {
+	return f.flow.Skip(state, scope)
+}
+
+// RestartScope returns a copy of the state in which the group of steps of the given scope starts again. See StepFlow.RestartScope.
+func (f *TypedStepFlow[T]) RestartScope(state State, scope string) (State, error) {
+	return f.flow.RestartScope(state, scope)
+}
+
+// TypedTransitions returns the list of transitions as defined by the typed steps specification. See Transitions.
+func TypedTransitions[T any](stepsSpec *TypedStepsSpec[T]) (core.Scope, []core.Transition, error) {
+	return Transitions(stepsSpec.spec)
+}
@@ -0,0 +1,211 @@
+package stepflow_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cbalan/go-stepflow"
+)
+
+func TestNewTyped(t *testing.T) {
+	type deployData struct {
+		ImageTag string `json:"imageTag"`
+		Attempts int    `json:"attempts"`
+		Deployed bool   `json:"deployed"`
+	}
+
+	prepare := func(ctx context.Context, data *deployData) error {
+		data.ImageTag = "v2"
+		return nil
+	}
+
+	deploy := func(ctx context.Context, data *deployData) error {
+		data.Attempts++
+		return nil
+	}
+
+	isDeployed := func(ctx context.Context, data *deployData) (bool, error) {
+		return data.Attempts >= 2, nil
+	}
+
+	shouldDeploy := func(ctx context.Context, data *deployData) (bool, error) {
+		return data.ImageTag != "", nil
+	}
+
+	markDeployed := func(ctx context.Context, data *deployData) error {
+		data.Deployed = true
+		return nil
+	}
+
+	flow, err := stepflow.NewTyped(stepflow.TypedNamed[deployData]("TestNewTyped").
+		Do("prepare", prepare).
+		Case("shouldDeploy", shouldDeploy, stepflow.TypedSteps[deployData]().
+			LoopUntil("deploy", isDeployed, stepflow.TypedSteps[deployData]().
+				Do("deploy", deploy)).
+			Do("markDeployed", markDeployed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The data is read back from the state on each Apply
+	var state stepflow.State
+	for i := range 8 {
+		var data deployData
+		state, err = flow.ApplyTyped(context.Background(), state, &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Logf("[%d] Stepflow new state: %s %s", i, state.Events, state.Data["data"])
+	}
+
+	// stepflow should have been completed after the expected number of iterations.
+	if !flow.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state.Events)
+	}
+
+	var data deployData
+	if err := json.Unmarshal(state.Data["data"], &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if data != (deployData{ImageTag: "v2", Attempts: 2, Deployed: true}) {
+		t.Fatalf("Unexpected data %+v", data)
+	}
+}
+
+func TestNewTyped_SignedAndEncrypted(t *testing.T) {
+	type onboardData struct {
+		CustomerId string `json:"customerId"`
+	}
+
+	cipher, err := stepflow.NewAESGCMCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flow, err := stepflow.NewTyped(stepflow.TypedNamed[onboardData]("TestNewTyped_SignedAndEncrypted").
+		Do("register", func(ctx context.Context, data *onboardData) error {
+			data.CustomerId = "c-42"
+			return nil
+		}).
+		Do("verify", func(ctx context.Context, data *onboardData) error {
+			if data.CustomerId != "c-42" {
+				return fmt.Errorf("unexpected customer id %s", data.CustomerId)
+			}
+			return nil
+		}), stepflow.WithStateSigner([]byte("secret")), stepflow.WithCipher(cipher))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The typed data is encrypted and signed along with the rest of the state
+	var state stepflow.State
+	for range 3 {
+		state, err = flow.ApplyTyped(context.Background(), state, &onboardData{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bytes.Contains(state.Data["encrypted"], []byte("c-42")) || state.Data["data"] != nil {
+			t.Fatalf("Expected encrypted data, got %s", state.Data)
+		}
+	}
+
+	if !flow.IsCompleted(state) {
+		t.Fatalf("Unexpected state %s", state.Events)
+	}
+}
+
+func TestNewTyped_RecoveryAndResults(t *testing.T) {
+	type deployData struct {
+		Region      string `json:"region"`
+		Recovered   bool   `json:"recovered"`
+		ReleaseName string `json:"releaseName"`
+	}
+
+	errQuota := errors.New("quota exceeded")
+	breaker := stepflow.NewCircuitBreaker(5, time.Minute)
+
+	flow, err := stepflow.NewTyped(stepflow.TypedDoResult(stepflow.TypedNamed[deployData]("TestNewTyped_RecoveryAndResults"), "createRelease",
+		func(ctx context.Context, data *deployData) (string, error) {
+			return "release-" + data.Region, nil
+		}).
+		OnError("deploy", func(err error) string { return "quota" }, map[string]stepflow.Recovery{
+			"quota": stepflow.TypedResume(stepflow.TypedSteps[deployData]().
+				Do("requestQuota", func(ctx context.Context, data *deployData) error {
+					data.Recovered = true
+					return nil
+				})),
+		}, stepflow.TypedSteps[deployData]().
+			WithCircuitBreaker("rollout", breaker, stepflow.TypedSteps[deployData]().
+				Do("rollout", func(ctx context.Context, data *deployData) error {
+					if !data.Recovered {
+						return errQuota
+					}
+
+					name, err := stepflow.Output[string](ctx, "createRelease")
+					data.ReleaseName = name
+					return err
+				}))), stepflow.WithCompactState(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := stepflow.State{}
+	for range 8 {
+		if state, err = flow.ApplyTyped(context.Background(), state, &deployData{Region: "eu"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expanded, err := flow.ExpandState(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !flow.IsCompleted(state) || expanded.Metadata["dictionary"] != "" {
+		t.Fatalf("Unexpected state %s", expanded.Events)
+	}
+
+	var data deployData
+	if err := json.Unmarshal(state.Data["data"], &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if data != (deployData{Region: "eu", Recovered: true, ReleaseName: "release-eu"}) {
+		t.Fatalf("Unexpected data %+v", data)
+	}
+}
+
+func TestNewTyped_StoredDataReplacesInitialValue(t *testing.T) {
+	type instanceData struct {
+		Counters map[string]int `json:"counters"`
+	}
+
+	flow, err := stepflow.NewTyped(stepflow.TypedNamed[instanceData]("TestNewTyped_StoredDataReplacesInitialValue").
+		WaitFor("never", func(ctx context.Context, data *instanceData) (bool, error) { return false, nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := flow.ApplyTyped(context.Background(), stepflow.State{}, &instanceData{Counters: map[string]int{"instA": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A reused struct holding the data of another instance is not merged into the stored data
+	data := &instanceData{Counters: map[string]int{"instB": 2}}
+	if _, err := flow.ApplyTyped(context.Background(), state, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(data.Counters) != "map[instA:1]" {
+		t.Fatalf("Unexpected data %+v", data)
+	}
+}